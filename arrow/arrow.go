@@ -0,0 +1,273 @@
+package arrow
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
+	"github.com/adyzng/go-duka/misc"
+	ar "github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+)
+
+// Schema metadata keys
+const (
+	MetaSymbol    = "symbol"
+	MetaTimeframe = "timeframe" // bars only
+	MetaPointSize = "point_size"
+	MetaDigits    = "digits"
+	MetaTimezone  = "timezone"
+	MetaStart     = "source_start" // RFC3339, inclusive
+	MetaEnd       = "source_end"   // RFC3339, exclusive
+)
+
+var (
+	ext = "arrow"
+	log = misc.NewLogger("Arrow", 3)
+
+	// BatchSize is the max rows of each record batch
+	BatchSize = 64 * 1024
+
+	timestampType = &ar.TimestampType{Unit: ar.Millisecond, TimeZone: "UTC"}
+
+	tickFields = []ar.Field{
+		{Name: "timestamp", Type: timestampType},
+		{Name: "ask", Type: ar.PrimitiveTypes.Float64},
+		{Name: "bid", Type: ar.PrimitiveTypes.Float64},
+		{Name: "ask_volume", Type: ar.PrimitiveTypes.Float64},
+		{Name: "bid_volume", Type: ar.PrimitiveTypes.Float64},
+	}
+	barFields = []ar.Field{
+		{Name: "timestamp", Type: timestampType},
+		{Name: "open", Type: ar.PrimitiveTypes.Float64},
+		{Name: "high", Type: ar.PrimitiveTypes.Float64},
+		{Name: "low", Type: ar.PrimitiveTypes.Float64},
+		{Name: "close", Type: ar.PrimitiveTypes.Float64},
+		{Name: "volume", Type: ar.PrimitiveTypes.Int64},
+		{Name: "spread", Type: ar.PrimitiveTypes.Int32},
+		{Name: "ticks", Type: ar.PrimitiveTypes.Int64},
+	}
+)
+
+// arrowRow is either one tick or one bar with its tick count
+type arrowRow struct {
+	tick  *core.TickData
+	bar   *hst.BarData
+	ticks int
+}
+
+// recordWriter is ipc.FileWriter or ipc.Writer
+type recordWriter interface {
+	Write(rec array.Record) error
+	Close() error
+}
+
+// ArrowFile write ticks or bars into Arrow IPC file (Feather v2),
+// which can be loaded by `pandas.read_feather` or `polars.read_ipc` without copy.
+// The IPC stream format is used instead if the output is not seekable, like stdout pipe.
+//
+type ArrowFile struct {
+	start    time.Time
+	end      time.Time
+	w        io.Writer
+	symbol   string
+	period   string
+	bars     bool
+	digits   int
+	rowCount int64
+	chClose  chan struct{}
+	chRows   chan *arrowRow
+}
+
+// FileName of arrow file, SYMBOL-START-END.arrow for ticks or SYMBOL-PERIOD-START-END.arrow for bars
+//
+func FileName(symbol, period string, start, end time.Time) string {
+	if period != "" {
+		symbol += "-" + period
+	}
+	return fmt.Sprintf("%s-%s-%s.%s", symbol, start.Format("2006-01-02"), end.Format("2006-01-02"), ext)
+}
+
+// New arrow output of ticks between [start, end) into `w`, `w` is not closed by Finish
+//
+func New(w io.Writer, start, end time.Time, symbol string) *ArrowFile {
+	return newArrow(w, "", false, start, end, symbol)
+}
+
+// NewBars arrow output of `period` bars between [start, end) into `w`
+//
+func NewBars(w io.Writer, period string, start, end time.Time, symbol string) *ArrowFile {
+	return newArrow(w, period, true, start, end, symbol)
+}
+
+func newArrow(w io.Writer, period string, bars bool, start, end time.Time, symbol string) *ArrowFile {
+	a := &ArrowFile{
+		start:   start,
+		end:     end,
+		w:       w,
+		symbol:  symbol,
+		period:  period,
+		bars:    bars,
+		digits:  core.Digits(symbol),
+		chClose: make(chan struct{}, 1),
+		chRows:  make(chan *arrowRow, 1024),
+	}
+
+	go a.worker()
+	return a
+}
+
+// Schema of the arrow file, the columns are fixed for ticks or bars
+//
+func (a *ArrowFile) Schema() *ar.Schema {
+	keys := []string{MetaSymbol, MetaPointSize, MetaDigits, MetaTimezone, MetaStart, MetaEnd}
+	values := []string{
+		a.symbol,
+		strconv.FormatFloat(math.Pow10(-a.digits), 'f', -1, 64),
+		strconv.Itoa(a.digits),
+		"UTC",
+		a.start.UTC().Format(time.RFC3339),
+		a.end.UTC().Format(time.RFC3339),
+	}
+
+	fields := tickFields
+	if a.bars {
+		fields = barFields
+		keys = append(keys, MetaTimeframe)
+		values = append(values, a.period)
+	}
+
+	md := ar.NewMetadata(keys, values)
+	return ar.NewSchema(fields, &md)
+}
+
+// Finish complete arrow file writing
+//
+func (a *ArrowFile) Finish() error {
+	close(a.chRows)
+	<-a.chClose
+	return nil
+}
+
+// PackTicks handle ticks data, the ticks are aggregated into one bar in bars output
+//
+func (a *ArrowFile) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	if a.bars {
+		bar := hst.NewBar(barTimestamp, ticks)
+		bar.Spread = hst.AvgSpread(ticks, math.Pow10(-a.digits))
+		a.chRows <- &arrowRow{bar: bar, ticks: len(ticks)}
+		a.rowCount++
+		return nil
+	}
+
+	for _, tick := range ticks {
+		a.chRows <- &arrowRow{tick: tick}
+		a.rowCount++
+	}
+	return nil
+}
+
+// append one row to the record builder
+func (a *ArrowFile) append(b *array.RecordBuilder, row *arrowRow) {
+	if bar := row.bar; bar != nil {
+		b.Field(0).(*array.TimestampBuilder).Append(ar.Timestamp(int64(bar.CTM) * 1000))
+		b.Field(1).(*array.Float64Builder).Append(bar.Open)
+		b.Field(2).(*array.Float64Builder).Append(bar.High)
+		b.Field(3).(*array.Float64Builder).Append(bar.Low)
+		b.Field(4).(*array.Float64Builder).Append(bar.Close)
+		b.Field(5).(*array.Int64Builder).Append(int64(bar.Volume))
+		b.Field(6).(*array.Int32Builder).Append(int32(bar.Spread))
+		b.Field(7).(*array.Int64Builder).Append(int64(row.ticks))
+		return
+	}
+
+	tick := row.tick
+	b.Field(0).(*array.TimestampBuilder).Append(ar.Timestamp(tick.Timestamp))
+	b.Field(1).(*array.Float64Builder).Append(tick.Ask)
+	b.Field(2).(*array.Float64Builder).Append(tick.Bid)
+	b.Field(3).(*array.Float64Builder).Append(tick.VolumeAsk)
+	b.Field(4).(*array.Float64Builder).Append(tick.VolumeBid)
+}
+
+// worker goroutine which flush record batches to disk
+//
+func (a *ArrowFile) worker() error {
+	var (
+		err  error
+		rows int
+		w    recordWriter
+	)
+
+	defer func() {
+		for range a.chRows {
+		}
+		close(a.chClose)
+		if a.bars {
+			log.Info("%s Saved Bars: %d.", a.period, a.rowCount)
+		} else {
+			log.Info("Saved Ticks: %d.", a.rowCount)
+		}
+	}()
+
+	mem := memory.NewGoAllocator()
+	schema := a.Schema()
+	if ws, ok := a.w.(io.WriteSeeker); ok && seekable(ws) {
+		w, err = ipc.NewFileWriter(ws, ipc.WithSchema(schema), ipc.WithAllocator(mem))
+	} else {
+		w = ipc.NewWriter(a.w, ipc.WithSchema(schema), ipc.WithAllocator(mem))
+	}
+	if err != nil {
+		log.Error("Create arrow writer failed: %v.", err)
+		return err
+	}
+
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+
+	flush := func() error {
+		rec := b.NewRecord()
+		defer rec.Release()
+		if err := w.Write(rec); err != nil {
+			log.Error("Write arrow record failed: %v.", err)
+			return err
+		}
+		rows = 0
+		return nil
+	}
+
+	for row := range a.chRows {
+		a.append(b, row)
+		if rows++; rows >= BatchSize {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil && rows > 0 {
+		err = flush()
+	}
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		log.Error("Close arrow writer failed: %v.", err)
+	}
+	return err
+}
+
+// seekable check if the output supports seek, which is false for pipes
+func seekable(ws io.WriteSeeker) bool {
+	_, err := ws.Seek(0, io.SeekCurrent)
+	return err == nil
+}
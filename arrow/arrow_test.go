@@ -0,0 +1,129 @@
+package arrow
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+)
+
+// testDay is the day of the tick fixtures
+var testDay = time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// tempDir create a temp folder for the output files, it's removed by the returned func
+func tempDir(t *testing.T) (string, func()) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	return dest, func() { os.RemoveAll(dest) }
+}
+
+// stepTicks create n ticks from start, one of each step, the prices rise by inc
+func stepTicks(start time.Time, step time.Duration, n int, inc float64) []*core.TickData {
+	ticks := make([]*core.TickData, 0, n)
+	for idx := 0; idx < n; idx++ {
+		ticks = append(ticks, &core.TickData{
+			Timestamp: start.Add(time.Duration(idx)*step).Unix() * 1000,
+			Ask:       1.05110 + float64(idx)*inc,
+			Bid:       1.05100 + float64(idx)*inc,
+			VolumeAsk: 1.5,
+			VolumeBid: 2.5,
+		})
+	}
+	return ticks
+}
+
+func TestArrowFile(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	ticks := stepTicks(testDay, time.Minute, 10, 0.0001)
+
+	defer func(size int) { BatchSize = size }(BatchSize)
+	BatchSize = 4
+	fpath := filepath.Join(dest, FileName("EURUSD", "", testDay, testDay.Add(24*time.Hour)))
+	f, err := os.Create(fpath)
+	if err != nil {
+		t.Fatalf("Create arrow file failed: %v.\n", err)
+	}
+	a := New(f, testDay, testDay.Add(24*time.Hour), "EURUSD")
+	a.PackTicks(0, ticks)
+	a.Finish()
+	f.Close()
+
+	if f, err = os.Open(filepath.Join(dest, "EURUSD-2017-01-02-2017-01-03.arrow")); err != nil {
+		t.Fatalf("Open arrow file failed: %v.\n", err)
+	}
+	defer f.Close()
+
+	r, err := ipc.NewFileReader(f)
+	if err != nil {
+		t.Fatalf("Read arrow file failed: %v.\n", err)
+	}
+	defer r.Close()
+
+	md := r.Schema().Metadata()
+	for key, expect := range map[string]string{
+		MetaSymbol:    "EURUSD",
+		MetaPointSize: "0.00001",
+		MetaTimezone:  "UTC",
+		MetaStart:     "2017-01-02T00:00:00Z",
+	} {
+		if idx := md.FindKey(key); idx < 0 || md.Values()[idx] != expect {
+			t.Errorf("Metadata %s expect %s, got %v.\n", key, expect, md)
+		}
+	}
+
+	if r.NumRecords() != 3 {
+		t.Fatalf("Expect 3 record batches, got %d.\n", r.NumRecords())
+	}
+	rec, err := r.Record(2)
+	if err != nil {
+		t.Fatalf("Read record failed: %v.\n", err)
+	}
+	if rec.NumRows() != 2 || rec.NumCols() != 5 {
+		t.Errorf("Unexpected last batch %dx%d.\n", rec.NumRows(), rec.NumCols())
+	}
+	if ts := rec.Column(0).(*array.Timestamp).Value(1); int64(ts) != ticks[9].Timestamp {
+		t.Errorf("Timestamp expect %d, got %d.\n", ticks[9].Timestamp, ts)
+	}
+	if bid := rec.Column(2).(*array.Float64).Value(1); bid != ticks[9].Bid {
+		t.Errorf("Bid expect %f, got %f.\n", ticks[9].Bid, bid)
+	}
+}
+
+func TestArrowStream(t *testing.T) {
+	ticks := []*core.TickData{
+		{Timestamp: testDay.Unix() * 1000, Ask: 1.05110, Bid: 1.05100},
+		{Timestamp: testDay.Unix()*1000 + 500, Ask: 1.05130, Bid: 1.05110},
+	}
+
+	var buf bytes.Buffer
+	a := NewBars(&buf, "M1", testDay, testDay.Add(24*time.Hour), "EURUSD")
+	a.PackTicks(uint32(testDay.Unix()), ticks)
+	a.Finish()
+
+	r, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Read arrow stream failed: %v.\n", err)
+	}
+	defer r.Release()
+
+	if !r.Next() {
+		t.Fatalf("Expect one record batch.\n")
+	}
+	rec := r.Record()
+	if rec.NumRows() != 1 || rec.NumCols() != 8 {
+		t.Errorf("Unexpected bars %dx%d.\n", rec.NumRows(), rec.NumCols())
+	}
+	if high := rec.Column(2).(*array.Float64).Value(0); high != 1.05110 {
+		t.Errorf("Expect high 1.05110, got %f.\n", high)
+	}
+}
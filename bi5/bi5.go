@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -17,11 +18,10 @@ import (
 )
 
 var (
-	ext         = "bi5"
-	log         = misc.NewLogger("Bi5", 3)
-	normSymbols = []string{"USDRUB", "XAGUSD", "XAUUSD"}
-	httpDownld  = core.NewDownloader()
-	emptBytes   = make([]byte, 0)
+	ext        = "bi5"
+	log        = misc.NewLogger("Bi5", 3)
+	httpDownld = core.NewDownloader()
+	emptBytes  = make([]byte, 0)
 )
 
 const (
@@ -92,9 +92,7 @@ func (b *Bi5) Save(data []byte) error {
 		return err
 	}
 
-	fname := fmt.Sprintf("%02dh.%s", b.dayH.Hour(), ext)
-	fpath := filepath.Join(b.dest, fname)
-
+	fpath := b.path()
 	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 666)
 	if err != nil {
 		log.Error("Create file %s failed: %v.", fpath, err)
@@ -114,10 +112,7 @@ func (b *Bi5) Save(data []byte) error {
 // Load bi5 data from file content
 //
 func (b *Bi5) Load() ([]byte, error) {
-
-	fname := fmt.Sprintf("%02dh.%s", b.dayH.Hour(), ext)
-	fpath := filepath.Join(b.dest, fname)
-
+	fpath := b.path()
 	f, err := os.OpenFile(fpath, os.O_RDONLY, 666)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -132,6 +127,19 @@ func (b *Bi5) Load() ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
+// Exist check if the bi5 file is saved in local
+//
+func (b *Bi5) Exist() bool {
+	_, err := os.Stat(b.path())
+	return err == nil
+}
+
+// path of local bi5 file
+func (b *Bi5) path() string {
+	fname := fmt.Sprintf("%02dh.%s", b.dayH.Hour(), ext)
+	return filepath.Join(b.dest, fname)
+}
+
 // Download from dukascopy
 //
 func (b *Bi5) Download() ([]byte, error) {
@@ -183,13 +191,8 @@ func (b *Bi5) decodeTickData(data []byte, symbol string, timeH time.Time) (*core
 		return nil, err
 	}
 
-	var point float64 = 100000
-	for _, sym := range normSymbols {
-		if symbol == sym {
-			point = 1000
-			break
-		}
-	}
+	// prices are integers of points, 10^-3 for JPY crosses and metals
+	point := math.Pow10(core.Digits(symbol))
 
 	t := core.TickData{
 		Symbol:    symbol,
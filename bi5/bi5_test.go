@@ -1,7 +1,10 @@
 package bi5
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"testing"
 	"time"
 )
@@ -58,3 +61,40 @@ func TestDownloadBi5(t *testing.T) {
 	}
 
 }
+
+func TestDecodeTickData(t *testing.T) {
+	hour := time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		symbol   string
+		ask, bid int32
+		expAsk   float64
+		expBid   float64
+	}{
+		{"EURUSD", 104712, 104705, 1.04712, 1.04705},
+		{"USDJPY", 117615, 117607, 117.615, 117.607},
+		{"XAUUSD", 1152460, 1152080, 1152.46, 1152.08},
+	}
+
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		for _, v := range []interface{}{int32(1500), tt.ask, tt.bid, float32(1.5), float32(2.25)} {
+			binary.Write(buf, binary.BigEndian, v)
+		}
+
+		b := New(hour, tt.symbol, "")
+		tick, err := b.decodeTickData(buf.Bytes(), tt.symbol, hour)
+		if err != nil {
+			t.Fatalf("%s: decode tick data failed: %v.\n", tt.symbol, err)
+		}
+		if tick.Timestamp != hour.Unix()*1000+1500 {
+			t.Errorf("%s: timestamp %d, expect %d", tt.symbol, tick.Timestamp, hour.Unix()*1000+1500)
+		}
+		if math.Abs(tick.Ask-tt.expAsk) > 1e-9 || math.Abs(tick.Bid-tt.expBid) > 1e-9 {
+			t.Errorf("%s: ask/bid %v/%v, expect %v/%v", tt.symbol, tick.Ask, tick.Bid, tt.expAsk, tt.expBid)
+		}
+		if tick.VolumeAsk != 1.5 || tick.VolumeBid != 2.25 {
+			t.Errorf("%s: volume %v/%v", tt.symbol, tick.VolumeAsk, tick.VolumeBid)
+		}
+	}
+}
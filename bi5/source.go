@@ -0,0 +1,135 @@
+package bi5
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// Source modes
+const (
+	ModeDownload = iota // download from dukascopy, save bi5 into cache folder
+	ModeLocal           // load from cache folder first, download if not exist
+	ModeCache           // load from cache folder only
+)
+
+// Source provide tick data of dukascopy bi5 files.
+// Bi5 files are saved as `dest/SYMBOL/YYYY/MM/DD/HHh.bi5`.
+//
+type Source struct {
+	dest string
+	mode int
+}
+
+type hReader struct {
+	Bi5  *Bi5
+	DayH time.Time
+	Data []byte
+}
+
+// NewSource create bi5 tick data source with cache folder `dest`
+//
+func NewSource(dest string, mode int) *Source {
+	return &Source{
+		dest: dest,
+		mode: mode,
+	}
+}
+
+// Ticks load every hour within [from, to), 24 goroutines at most in parallel
+//
+func (s *Source) Ticks(symbol string, from, to time.Time) ([]*core.TickData, error) {
+	ticks := make([]*core.TickData, 0, 2048)
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		end := day.Add(24 * time.Hour)
+		if end.After(to) {
+			end = to
+		}
+		for data := range s.fetch(symbol, day, end) {
+			t, err := data.Bi5.Decode(data.Data[:])
+			if err != nil {
+				log.Error("Decode bi5 %s: %s failed: %v.", symbol, data.DayH.Format("2006-01-02:15H"), err)
+				continue
+			}
+
+			// 保留 bi5 数据
+			if err := data.Bi5.Save(data.Data[:]); err != nil {
+				log.Error("Save Bi5 %s: %s failed: %v.", symbol, data.DayH.Format("2006-01-02:15H"), err)
+				continue
+			}
+			ticks = append(ticks, t...)
+		}
+	}
+
+	// 下载的数据并不一定按时间顺序排序
+	sort.Slice(ticks, func(i, j int) bool {
+		return ticks[i].Timestamp < ticks[j].Timestamp
+	})
+	return ticks, nil
+}
+
+// Close nothing to release
+//
+func (s *Source) Close() error {
+	return nil
+}
+
+// fetch every hour within [from, to) in parallel
+func (s *Source) fetch(symbol string, from, to time.Time) <-chan *hReader {
+	ch := make(chan *hReader, 24)
+
+	go func() {
+		defer close(ch)
+		var wg sync.WaitGroup
+
+		for dayH := from.Truncate(time.Hour); dayH.Before(to); dayH = dayH.Add(time.Hour) {
+			//
+			//  周六没数据，跳过
+			//
+			if dayH.Weekday() == time.Saturday {
+				continue
+			}
+
+			wg.Add(1)
+			go func(dayH time.Time) {
+				defer wg.Done()
+				bi5File := New(dayH, symbol, s.dest)
+
+				var (
+					str  string
+					err  error
+					data []byte
+				)
+				switch s.mode {
+				case ModeCache:
+					if !bi5File.Exist() {
+						return
+					}
+					str = "Load Bi5"
+					data, err = bi5File.Load()
+				case ModeLocal:
+					str = "Load Bi5"
+					data, err = bi5File.Load()
+				default:
+					str = "Download Bi5"
+					data, err = bi5File.Download()
+				}
+
+				if err != nil {
+					log.Error("%s, %s failed: %v.", str, dayH.Format("2006-01-02:15H"), err)
+					return
+				}
+				if len(data) > 0 {
+					ch <- &hReader{Data: data[:], DayH: dayH, Bi5: bi5File}
+				}
+			}(dayH)
+		}
+
+		wg.Wait()
+		log.Trace("%s %s loaded.", symbol, from.Format("2006-01-02"))
+	}()
+
+	return ch
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"math"
+	"strings"
+)
+
+var (
+	// symbols quoted with 3 digits in dukascopy besides the JPY crosses
+	digits3Symbols = []string{"USDRUB", "XAGUSD", "XAUUSD"}
+)
+
+// Digits return the amount of digits after decimal point of the symbol price
+//
+func Digits(symbol string) int {
+	symbol = strings.ToUpper(symbol)
+	if strings.HasSuffix(symbol, "JPY") {
+		return 3
+	}
+	for _, sym := range digits3Symbols {
+		if symbol == sym {
+			return 3
+		}
+	}
+	return 5
+}
+
+// PointSize return the minimal price change of the symbol, like 0.00001
+//
+func PointSize(symbol string) float64 {
+	return math.Pow10(-Digits(symbol))
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Markup side values
+const (
+	MarkupBoth = "both" // widen ask and bid symmetrically
+	MarkupAsk  = "ask"  // widen on ask side only
+	MarkupBid  = "bid"  // widen on bid side only
+)
+
+// MarkupWindow extra markup applied in a time of day range (UTC)
+//
+type MarkupWindow struct {
+	From   time.Duration // offset from 00:00 UTC
+	To     time.Duration // offset from 00:00 UTC, window crosses midnight if To <= From
+	Points float64       // extra markup in points
+}
+
+// Markup widen the raw dukascopy spread to simulate broker's spread and commission.
+// The extra spread of each tick is:
+//
+//	Fixed + Commission + Schedule + (Ask - Bid) * Percent / 100
+//
+type Markup struct {
+	Fixed      float64        // fixed markup in points
+	Percent    float64        // markup in percentage of the raw spread
+	Commission float64        // round-turn commission expressed in points
+	Side       string         // both, ask, bid
+	Schedule   []MarkupWindow // time of day markup
+	point      float64
+}
+
+// NewMarkup create a spread markup for symbol, `side` is one of both/ask/bid
+//
+func NewMarkup(symbol, side string, fixed, percent, commission float64, schedule []MarkupWindow) (*Markup, error) {
+	side = strings.ToLower(side)
+	switch side {
+	case "":
+		side = MarkupBoth
+	case MarkupBoth, MarkupAsk, MarkupBid:
+		break
+	default:
+		return nil, fmt.Errorf("invalid markup side: %s", side)
+	}
+
+	return &Markup{
+		Fixed:      fixed,
+		Percent:    percent,
+		Commission: commission,
+		Side:       side,
+		Schedule:   schedule,
+		point:      PointSize(symbol),
+	}, nil
+}
+
+// ParseMarkupSchedule parse time of day markup like: 21:00-22:00=15,22:00-23:00=5
+//
+func ParseMarkupSchedule(s string) ([]MarkupWindow, error) {
+	windows := make([]MarkupWindow, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		// 21:00-22:00=15 => [21:00-22:00 15]
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid markup window: %s", item)
+		}
+		span := strings.SplitN(kv[0], "-", 2)
+		if len(span) != 2 {
+			return nil, fmt.Errorf("invalid markup window: %s", item)
+		}
+
+		var (
+			err error
+			w   MarkupWindow
+		)
+		if w.From, err = parseClock(span[0]); err != nil {
+			return nil, err
+		}
+		if w.To, err = parseClock(span[1]); err != nil {
+			return nil, err
+		}
+		if w.Points, err = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err != nil {
+			return nil, fmt.Errorf("invalid markup points: %s", item)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseClock convert `15:04` into offset of the day
+func parseClock(s string) (time.Duration, error) {
+	tm, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	return time.Duration(tm.Hour())*time.Hour + time.Duration(tm.Minute())*time.Minute, nil
+}
+
+// contains check if the time of day `tod` is inside the window
+func (w *MarkupWindow) contains(tod time.Duration) bool {
+	if w.From < w.To {
+		return tod >= w.From && tod < w.To
+	}
+	// crosses midnight, like 23:00-01:00
+	return tod >= w.From || tod < w.To
+}
+
+// Extra return the price distance to add to the spread of tick
+//
+func (m *Markup) Extra(tick *TickData) float64 {
+	points := m.Fixed + m.Commission
+	if len(m.Schedule) > 0 {
+		tm := tick.UTC()
+		tod := tm.Sub(time.Date(tm.Year(), tm.Month(), tm.Day(), 0, 0, 0, 0, time.UTC))
+		for i := range m.Schedule {
+			if m.Schedule[i].contains(tod) {
+				points += m.Schedule[i].Points
+			}
+		}
+	}
+	return points*m.point + (tick.Ask-tick.Bid)*m.Percent/100
+}
+
+// Apply widen the spread of ticks in place
+//
+func (m *Markup) Apply(ticks []*TickData) {
+	for _, tick := range ticks {
+		extra := m.Extra(tick)
+		switch m.Side {
+		case MarkupAsk:
+			tick.Ask += extra
+		case MarkupBid:
+			tick.Bid -= extra
+		default:
+			tick.Ask += extra / 2
+			tick.Bid -= extra / 2
+		}
+	}
+}
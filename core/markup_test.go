@@ -0,0 +1,65 @@
+package core
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMarkupApply(t *testing.T) {
+	schedule, err := ParseMarkupSchedule("21:00-22:00=10, 23:30-00:30=4")
+	if err != nil {
+		t.Fatalf("Parse schedule failed: %v.\n", err)
+	}
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		side     string
+		offset   time.Duration
+		ask, bid float64
+	}{
+		{MarkupBoth, 10 * time.Hour, 1.05001, 1.04999},
+		{MarkupBoth, 21*time.Hour + 30*time.Minute, 1.05006, 1.04994},
+		{MarkupAsk, 10 * time.Hour, 1.05002, 1.05000},
+		{MarkupBid, 15 * time.Minute, 1.05000, 1.04994},
+	}
+
+	for _, c := range cases {
+		m, err := NewMarkup("EURUSD", c.side, 1, 100, 1, schedule)
+		if err != nil {
+			t.Fatalf("New markup failed: %v.\n", err)
+		}
+
+		// fixed 1 + commission 1 points, raw spread is zero so percent markup is not involved
+		tick := &TickData{
+			Timestamp: day.Add(c.offset).Unix() * 1000,
+			Ask:       1.05000,
+			Bid:       1.05000,
+		}
+		m.Apply([]*TickData{tick})
+
+		if math.Abs(tick.Ask-c.ask) > 1e-9 || math.Abs(tick.Bid-c.bid) > 1e-9 {
+			t.Errorf("%s %v: got %.5f/%.5f, expect %.5f/%.5f.\n",
+				c.side, c.offset, tick.Ask, tick.Bid, c.ask, c.bid)
+		}
+	}
+}
+
+func TestMarkupPercent(t *testing.T) {
+	m, _ := NewMarkup("USDJPY", MarkupBoth, 0, 50, 0, nil)
+	tick := &TickData{Ask: 112.010, Bid: 112.000}
+	m.Apply([]*TickData{tick})
+
+	if spread := (tick.Ask - tick.Bid) / PointSize("USDJPY"); math.Abs(spread-15) > 1e-6 {
+		t.Errorf("Expect spread 15 points, got %f.\n", spread)
+	}
+}
+
+func TestMarkupInvalid(t *testing.T) {
+	if _, err := NewMarkup("EURUSD", "middle", 1, 0, 0, nil); err == nil {
+		t.Errorf("Expect invalid side error.\n")
+	}
+	if _, err := ParseMarkupSchedule("21:00=10"); err == nil {
+		t.Errorf("Expect invalid schedule error.\n")
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Destination create the output streams of converters by name.
+// Converters only encode data into io.Writer, the file naming and opening are done here.
+//
+type Destination interface {
+	// Create the output stream `name`, which may contain `/` for sub folders
+	Create(name string) (io.WriteCloser, error)
+}
+
+// folder save every output as a file under the directory
+type folder string
+
+// NewFolder create a Destination which save outputs as files under `dir`
+//
+func NewFolder(dir string) Destination {
+	return folder(dir)
+}
+
+func (d folder) Create(name string) (io.WriteCloser, error) {
+	fpath := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fpath), 666); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(fpath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 666)
+}
+
+// writerDest write every output into the same writer
+type writerDest struct {
+	w io.Writer
+}
+
+// nopCloser keep `w` open when the output is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// NewWriterDest create a Destination which write every output into `w`, like stdout or a buffer,
+// the names are ignored and `w` is never closed.
+//
+func NewWriterDest(w io.Writer) Destination {
+	return &writerDest{w: w}
+}
+
+func (d *writerDest) Create(name string) (io.WriteCloser, error) {
+	return nopCloser{d.w}, nil
+}
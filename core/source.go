@@ -0,0 +1,84 @@
+package core
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// Source provide tick data from dukascopy, local files and so on
+type Source interface {
+	// Ticks return all the ticks of `symbol` within [from, to), ordered by timestamp.
+	// Sources reading files sequentially require increasing and non-overlapping ranges.
+	Ticks(symbol string, from, to time.Time) ([]*TickData, error)
+	// Close release the source
+	Close() error
+}
+
+// TickReader read tick data one by one, return io.EOF at the end
+type TickReader interface {
+	Read() (*TickData, error)
+	Close() error
+}
+
+// readerSource wrap TickReader as Source
+//
+type readerSource struct {
+	r    TickReader
+	peek *TickData
+	eof  bool
+}
+
+// NewReaderSource create a Source from TickReader which produce ticks ordered by timestamp
+//
+func NewReaderSource(r TickReader) Source {
+	return &readerSource{r: r}
+}
+
+// Ticks read ticks until `to`, ticks before `from` are dropped
+//
+func (s *readerSource) Ticks(symbol string, from, to time.Time) ([]*TickData, error) {
+	var (
+		start = from.UnixNano() / int64(time.Millisecond)
+		end   = to.UnixNano() / int64(time.Millisecond)
+		ticks = make([]*TickData, 0, 1024)
+	)
+
+	for !s.eof {
+		tick := s.peek
+		if tick == nil {
+			var err error
+			if tick, err = s.r.Read(); err != nil {
+				if err == io.EOF {
+					s.eof = true
+					break
+				}
+				return ticks, err
+			}
+		}
+
+		if tick.Timestamp >= end {
+			// keep it for the next range
+			s.peek = tick
+			break
+		}
+
+		s.peek = nil
+		if tick.Timestamp >= start {
+			tick.Symbol = symbol
+			ticks = append(ticks, tick)
+		}
+	}
+
+	// file may not be strictly ordered
+	sort.SliceStable(ticks, func(i, j int) bool {
+		return ticks[i].Timestamp < ticks[j].Timestamp
+	})
+	return ticks, nil
+}
+
+// Close the underlying reader
+//
+func (s *readerSource) Close() error {
+	return s.r.Close()
+}
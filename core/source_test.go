@@ -0,0 +1,51 @@
+package core
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+type sliceReader struct {
+	ticks []*TickData
+}
+
+func (s *sliceReader) Read() (*TickData, error) {
+	if len(s.ticks) == 0 {
+		return nil, io.EOF
+	}
+	tick := s.ticks[0]
+	s.ticks = s.ticks[1:]
+	return tick, nil
+}
+
+func (s *sliceReader) Close() error {
+	return nil
+}
+
+func TestReaderSource(t *testing.T) {
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	r := &sliceReader{}
+	for _, h := range []int{-1, 1, 3, 25, 26, 49} {
+		r.ticks = append(r.ticks, &TickData{Timestamp: day.Add(time.Duration(h)*time.Hour).Unix() * 1000})
+	}
+
+	src := NewReaderSource(r)
+	defer src.Close()
+
+	for idx, expect := range []int{2, 2, 1, 0} {
+		from := day.Add(time.Duration(idx) * 24 * time.Hour)
+		ticks, err := src.Ticks("EURUSD", from, from.Add(24*time.Hour))
+		if err != nil {
+			t.Fatalf("Read ticks failed: %v.\n", err)
+		}
+		if len(ticks) != expect {
+			t.Errorf("Day %d: expect %d ticks, got %d.\n", idx, expect, len(ticks))
+		}
+		for _, tick := range ticks {
+			if tick.Symbol != "EURUSD" || tick.UTC().Before(from) {
+				t.Errorf("Day %d: unexpected tick %v.\n", idx, tick)
+			}
+		}
+	}
+}
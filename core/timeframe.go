@@ -3,6 +3,13 @@ package core
 import (
 	"regexp"
 	"strconv"
+	"time"
+)
+
+const (
+	weekMinutes  = 7 * 24 * 60
+	monthMinutes = 30 * 24 * 60 // nominal, MN bars follow calendar months
+	firstSunday  = 3 * 24 * 60 * 60
 )
 
 var (
@@ -11,8 +18,8 @@ var (
 		"M":  1,
 		"H":  60,
 		"D":  24 * 60,
-		"W":  7 * 24 * 60,
-		"MN": 30 * 24 * 60,
+		"W":  weekMinutes,
+		"MN": monthMinutes,
 	}
 )
 
@@ -46,6 +53,36 @@ func ParseTimeframe(period string) (uint32, string) {
 	return 1, "M1" // M1 by default
 }
 
+// BarTime return the beginning of the bar in `timeframe` minutes which `seconds` belongs to.
+// Like MT4, W1 bars begin on Sunday 00:00 and MN bars on the first day of the calendar month.
+//
+func BarTime(seconds, timeframe uint32) uint32 {
+	delta := timeframe * 60
+	switch {
+	case timeframe >= monthMinutes && timeframe%monthMinutes == 0:
+		n := int(timeframe / monthMinutes)
+		t := time.Unix(int64(seconds), 0).UTC()
+		months := t.Year()*12 + int(t.Month()) - 1
+		months -= months % n
+		return uint32(time.Date(months/12, time.Month(months%12+1), 1, 0, 0, 0, 0, time.UTC).Unix())
+	case timeframe >= weekMinutes && timeframe%weekMinutes == 0 && seconds >= firstSunday:
+		// epoch is Thursday, weeks are counted from 1970-01-04
+		return seconds - (seconds-firstSunday)%delta
+	}
+	return seconds - seconds%delta
+}
+
+// NextBarTime return the beginning of the bar following the one which `seconds` belongs to
+//
+func NextBarTime(seconds, timeframe uint32) uint32 {
+	bar := BarTime(seconds, timeframe)
+	if timeframe >= monthMinutes && timeframe%monthMinutes == 0 {
+		t := time.Unix(int64(bar), 0).UTC()
+		return uint32(t.AddDate(0, int(timeframe/monthMinutes), 0).Unix())
+	}
+	return bar + timeframe*60
+}
+
 // NewTimeframe create an new timeframe
 func NewTimeframe(period, symbol string, out Converter) Converter {
 	min, str := ParseTimeframe(period)
@@ -97,11 +134,11 @@ func (tf *Timeframe) worker() error {
 	for tick := range tf.chTicks {
 		// Beginning of the bar's timeline.
 		tickSeconds = uint32(tick.Timestamp / 1000)
-		tickBarTime = tickSeconds - tickSeconds%tf.deltaTimestamp
+		tickBarTime = BarTime(tickSeconds, tf.timeframe)
 
 		if tf.startTimestamp == 0 {
 			tf.startTimestamp = tickBarTime
-			tf.endTimestamp = tickBarTime + tf.deltaTimestamp
+			tf.endTimestamp = NextBarTime(tickBarTime, tf.timeframe)
 		}
 
 		//Determines the end of the current bar.
@@ -114,7 +151,7 @@ func (tf *Timeframe) worker() error {
 
 			// Next bar's timeline will begin from this new tick's bar
 			tf.startTimestamp = tickBarTime
-			tf.endTimestamp = tf.startTimestamp + tf.deltaTimestamp
+			tf.endTimestamp = NextBarTime(tf.startTimestamp, tf.timeframe)
 
 			// start next round bar
 			barTicks = append(barTicks, tick)
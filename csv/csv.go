@@ -1,44 +1,101 @@
 package csv
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
 	"github.com/adyzng/go-duka/misc"
 )
 
+// Csv output modes
+const (
+	ModeTicks = "ticks" // one row per tick
+	ModeBars  = "bars"  // one OHLCV row per bar: time,open,high,low,close,volume,spread,ticks
+	ModeMT4   = "mt4"   // one row per bar formatted by hst.BarData.Strings, for MT4 History Center import
+)
+
 var (
 	ext       = "CSV"
 	log       = misc.NewLogger("CSV", 3)
 	csvHeader = []string{"time", "ask", "bid", "ask_volume", "bid_volume"}
+	barHeader = []string{"time", "open", "high", "low", "close", "volume", "spread", "ticks"}
+	mt4Header = []string{"date", "time", "open", "high", "low", "close", "volume"}
 )
 
+// csvRow is one row with timestamp in milliseconds for partition
+type csvRow struct {
+	timestamp int64
+	fields    []string
+}
+
 // CsvDump save csv format
 type CsvDump struct {
-	day       time.Time
-	end       time.Time
-	dest      string
-	symbol    string
-	header    bool
-	tickCount int64
-	chClose   chan struct{}
-	chTicks   chan *core.TickData
+	day      time.Time
+	end      time.Time
+	dst      core.Destination
+	symbol   string
+	period   string
+	mode     string
+	header   bool
+	digits   int
+	layout   *Layout
+	part     *Partition
+	rowCount int64
+	chClose  chan struct{}
+	chRows   chan *csvRow
+}
+
+// New Csv file, the default layout and one uncompressed file are used if `layout` or `part` is nil
+func New(start, end time.Time, header bool, symbol, dest string, layout *Layout, part *Partition) *CsvDump {
+	return newCsv(ModeTicks, "", start, end, header, symbol, core.NewFolder(dest), layout, part)
+}
+
+// NewBars Csv file of `period` bars, `mode` is one of ModeBars, ModeMT4
+func NewBars(mode, period string, start, end time.Time, header bool, symbol, dest string, layout *Layout, part *Partition) *CsvDump {
+	return newCsv(mode, period, start, end, header, symbol, core.NewFolder(dest), layout, part)
+}
+
+// NewWriter Csv of ticks written into `w` without partition, `w` is not closed by Finish
+func NewWriter(w io.Writer, header bool, symbol string, layout *Layout) *CsvDump {
+	return newCsv(ModeTicks, "", time.Time{}, time.Time{}, header, symbol, core.NewWriterDest(w), layout, nil)
+}
+
+// NewBarsWriter Csv of `period` bars written into `w` without partition
+func NewBarsWriter(w io.Writer, mode, period string, header bool, symbol string, layout *Layout) *CsvDump {
+	return newCsv(mode, period, time.Time{}, time.Time{}, header, symbol, core.NewWriterDest(w), layout, nil)
 }
 
-// New Csv file
-func New(start, end time.Time, header bool, symbol, dest string) *CsvDump {
+func newCsv(mode, period string, start, end time.Time, header bool, symbol string, dst core.Destination, layout *Layout, part *Partition) *CsvDump {
+	if layout == nil {
+		layout, _ = NewLayout("", "", "")
+	}
+	if part == nil {
+		part = &Partition{}
+	}
+
+	digits := layout.Digits
+	if digits <= 0 {
+		digits = core.Digits(symbol)
+	}
+
 	csv := &CsvDump{
 		day:     start,
 		end:     end,
-		dest:    dest,
+		dst:     dst,
 		symbol:  symbol,
+		period:  period,
+		mode:    mode,
 		header:  header,
+		digits:  digits,
+		layout:  layout,
+		part:    part,
 		chClose: make(chan struct{}, 1),
-		chTicks: make(chan *core.TickData, 1024),
+		chRows:  make(chan *csvRow, 1024),
 	}
 
 	go csv.worker()
@@ -48,19 +105,39 @@ func New(start, end time.Time, header bool, symbol, dest string) *CsvDump {
 // Finish complete csv file writing
 //
 func (c *CsvDump) Finish() error {
-	close(c.chTicks)
+	close(c.chRows)
 	<-c.chClose
 	return nil
 }
 
-// PackTicks handle ticks data
+// PackTicks handle ticks data, the ticks are aggregated into one bar in bar modes
 //
 func (c *CsvDump) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
-	for _, tick := range ticks {
-		select {
-		case c.chTicks <- tick:
-			c.tickCount++
-			break
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	switch c.mode {
+	case ModeBars, ModeMT4:
+		bar := hst.NewBar(barTimestamp, ticks)
+		row := &csvRow{timestamp: int64(barTimestamp) * 1000}
+		if c.mode == ModeMT4 {
+			// 2006.01.02,15:04 => [2006.01.02 15:04], avoid quoting by csv writer
+			ss := bar.Strings(c.digits)
+			row.fields = append(strings.SplitN(ss[0], ",", 2), ss[1:]...)
+		} else {
+			bar.Spread = hst.AvgSpread(ticks, math.Pow10(-c.digits))
+			row.fields = c.layout.BarStrings(bar, len(ticks), c.digits)
+		}
+		c.chRows <- row
+		c.rowCount++
+	default:
+		for _, tick := range ticks {
+			select {
+			case c.chRows <- &csvRow{tick.Timestamp, c.layout.Strings(tick, c.digits)}:
+				c.rowCount++
+				break
+			}
 		}
 	}
 	return nil
@@ -69,37 +146,84 @@ func (c *CsvDump) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
 // worker goroutine which flust data to disk
 //
 func (c *CsvDump) worker() error {
-	fname := fmt.Sprintf("%s-%s-%s.%s",
-		c.symbol,
-		c.day.Format("2006-01-02"),
-		c.end.Format("2006-01-02"),
-		ext)
-
-	fpath := filepath.Join(c.dest, fname)
-	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 666)
-	if err != nil {
-		log.Error("Failed to create file %s, error %v.", fpath, err)
-		return err
+	var (
+		err    error
+		seq    int
+		part   *partFile
+		prefix = c.symbol
+	)
+	if c.mode != ModeTicks {
+		// EURUSD-M15-2017-01-01-2017-02-01.CSV
+		prefix = fmt.Sprintf("%s-%s", c.symbol, c.period)
 	}
 
 	defer func() {
-		f.Close()
+		if part != nil {
+			part.Close()
+		}
+		for range c.chRows {
+		}
 		close(c.chClose)
-		log.Info("Saved Ticks: %d.", c.tickCount)
+		if c.mode == ModeTicks {
+			log.Info("Saved Ticks: %d.", c.rowCount)
+		} else {
+			log.Info("%s Saved Bars: %d.", c.period, c.rowCount)
+		}
 	}()
 
-	csv := csv.NewWriter(f)
-	defer csv.Flush()
+	// open next file of partition `key`
+	next := func(key string) error {
+		if part != nil {
+			part.Close()
+			part = nil
+		}
+		if key == "" {
+			key = fmt.Sprintf("%s-%s", c.day.Format("2006-01-02"), c.end.Format("2006-01-02"))
+		}
+
+		name := c.part.fileName(prefix, key, seq)
+		if part, err = c.part.openPart(c.dst, name, key, c.layout.Comma); err != nil {
+			return err
+		}
 
-	// write header
-	if c.header {
-		csv.Write(csvHeader)
+		// write header
+		if c.header {
+			switch c.mode {
+			case ModeBars:
+				part.w.Write(c.layout.barHeader())
+			case ModeMT4:
+				part.w.Write(mt4Header)
+			default:
+				part.w.Write(c.layout.header())
+			}
+		}
+		return nil
+	}
+
+	// single file is created even if there is no data
+	if c.part.Period == "" {
+		seq = 1
+		if err = next(""); err != nil {
+			return err
+		}
 	}
 
-	// write tick one by one
-	for tick := range c.chTicks {
-		if err = csv.Write(tick.Strings()); err != nil {
-			log.Error("Write csv %s failed: %v.", fpath, err)
+	// write row one by one
+	for row := range c.chRows {
+		key := c.part.key(row.timestamp)
+		if part == nil || (key != "" && key != part.key) {
+			seq = 1
+			err = next(key)
+		} else if part.full(c.part.Size) {
+			seq++
+			err = next(key)
+		}
+		if err != nil {
+			break
+		}
+
+		if err = part.w.Write(row.fields); err != nil {
+			log.Error("Write csv %s failed: %v.", part.fpath, err)
 			break
 		}
 	}
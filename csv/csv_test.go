@@ -1,11 +1,20 @@
 package csv
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/adyzng/go-duka/bi5"
+	"github.com/adyzng/go-duka/core"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestCloseChan(t *testing.T) {
@@ -29,7 +38,7 @@ func TestDumpCsv(t *testing.T) {
 		t.Fatalf("Invalid date format\n")
 	}
 
-	csv := New(day, day, true, symbol, dest)
+	csv := New(day, day, true, symbol, dest, nil, nil)
 	defer csv.Finish()
 
 	for h := 0; h < 24; h++ {
@@ -53,3 +62,340 @@ func TestDumpCsv(t *testing.T) {
 		csv.PackTicks(0, ticks)
 	}
 }
+
+func TestReadCsv(t *testing.T) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	defer os.RemoveAll(dest)
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := []*core.TickData{
+		{Symbol: "EURUSD", Timestamp: day.Unix()*1000 + 123, Ask: 1.05236, Bid: 1.05148, VolumeAsk: 0.75, VolumeBid: 1.5},
+		{Symbol: "EURUSD", Timestamp: day.Unix()*1000 + 60456, Ask: 1.05240, Bid: 1.05150, VolumeAsk: 1, VolumeBid: 2.25},
+	}
+
+	// write by CsvDump then read back
+	c := New(day, day, true, "EURUSD", dest, nil, nil)
+	c.PackTicks(0, ticks)
+	c.Finish()
+
+	fpath := filepath.Join(dest, "EURUSD-2017-01-02-2017-01-02.CSV")
+	r, err := NewReader(fpath, "EURUSD", nil)
+	if err != nil {
+		t.Fatalf("Open csv failed: %v.\n", err)
+	}
+	defer r.Close()
+
+	got, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("Read csv failed: %v.\n", err)
+	}
+	if len(got) != len(ticks) {
+		t.Fatalf("Expect %d ticks, got %d.\n", len(ticks), len(got))
+	}
+	for i := range ticks {
+		if *got[i] != *ticks[i] {
+			t.Errorf("Tick %d: expect %v, got %v.\n", i, ticks[i], got[i])
+		}
+	}
+}
+
+func TestReadCsvLayout(t *testing.T) {
+	fpath := filepath.Join(os.TempDir(), "duka-layout.csv")
+	data := "2017.01.02;22:00:20;1.05148;1.05236\n2017.01.02;22:00:21;1.05150;1.05240\n"
+	if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+		t.Fatalf("Write csv failed: %v.\n", err)
+	}
+	defer os.Remove(fpath)
+
+	layout, err := NewLayout("date,time,bid,ask", ";", "2006.01.02 15:04:05")
+	if err != nil {
+		t.Fatalf("Invalid layout: %v.\n", err)
+	}
+
+	r, err := NewReader(fpath, "EURUSD", layout)
+	if err != nil {
+		t.Fatalf("Open csv failed: %v.\n", err)
+	}
+	defer r.Close()
+
+	ticks, err := r.ReadAll()
+	if err != nil || len(ticks) != 2 {
+		t.Fatalf("Read csv failed: %d, %v.\n", len(ticks), err)
+	}
+
+	expect := time.Date(2017, 1, 2, 22, 0, 20, 0, time.UTC)
+	if !ticks[0].UTC().Equal(expect) || ticks[0].Ask != 1.05236 || ticks[0].Bid != 1.05148 {
+		t.Errorf("Unexpected tick %v.\n", ticks[0])
+	}
+}
+
+func TestCsvLayoutStrings(t *testing.T) {
+	tick := &core.TickData{
+		Timestamp: time.Date(2017, 1, 2, 22, 0, 20, 786*int(time.Millisecond), time.UTC).UnixNano() / 1e6,
+		Ask:       117.236,
+		Bid:       117.221,
+		VolumeAsk: 0.75,
+		VolumeBid: 1.5,
+	}
+
+	cases := []struct {
+		columns, format string
+		expect          []string
+	}{
+		{"", "", []string{"2017-01-02 22:00:20.786", "117.236", "117.221", "0.75", "1.50"}},
+		{"date,time,bid,ask", "mt4", []string{"2017.01.02", "22:00:20", "117.221", "117.236"}},
+		{"time,mid,spread", "unix_ms", []string{"1483394420786", "117.2285", "15.0"}},
+		{"time,bid", "rfc3339", []string{"2017-01-02T22:00:20.786Z", "117.221"}},
+	}
+
+	for _, c := range cases {
+		layout, err := NewLayout(c.columns, ";", c.format)
+		if err != nil {
+			t.Fatalf("Invalid layout %s: %v.\n", c.columns, err)
+		}
+		got := layout.Strings(tick, core.Digits("USDJPY"))
+		if strings.Join(got, ";") != strings.Join(c.expect, ";") {
+			t.Errorf("Layout %s %s: expect %v, got %v.\n", c.columns, c.format, c.expect, got)
+		}
+	}
+
+	if _, err := NewLayout("date,time,bid", "", "unix"); err == nil {
+		t.Errorf("Expect error for date column with epoch time.\n")
+	}
+}
+
+func TestDumpCsvBars(t *testing.T) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	defer os.RemoveAll(dest)
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ms := day.Unix() * 1000
+	ticks := []*core.TickData{
+		{Timestamp: ms + 1000, Ask: 1.05110, Bid: 1.05100, VolumeBid: 1},
+		{Timestamp: ms + 2000, Ask: 1.05320, Bid: 1.05300, VolumeBid: 2},
+		{Timestamp: ms + 3000, Ask: 1.05060, Bid: 1.05050, VolumeBid: 1},
+		{Timestamp: ms + 61000, Ask: 1.05210, Bid: 1.05200, VolumeBid: 1},
+	}
+
+	for _, mode := range []string{ModeBars, ModeMT4} {
+		tf := core.NewTimeframe("M1", "EURUSD", NewBars(mode, "M1", day, day, true, "EURUSD", dest, nil, nil))
+		tf.PackTicks(0, ticks)
+		tf.Finish()
+
+		bs, err := ioutil.ReadFile(filepath.Join(dest, "EURUSD-M1-2017-01-02-2017-01-02.CSV"))
+		if err != nil {
+			t.Fatalf("Read csv failed: %v.\n", err)
+		}
+
+		expect := "time,open,high,low,close,volume,spread,ticks\n" +
+			"2017-01-02 00:00:00.000,1.05100,1.05300,1.05050,1.05050,4,13,3\n" +
+			"2017-01-02 00:01:00.000,1.05200,1.05200,1.05200,1.05200,1,10,1\n"
+		if mode == ModeMT4 {
+			expect = "date,time,open,high,low,close,volume\n" +
+				"2017.01.02,00:00,1.05100,1.05300,1.05050,1.05050,4\n" +
+				"2017.01.02,00:01,1.05200,1.05200,1.05200,1.05200,1\n"
+		}
+		if string(bs) != expect {
+			t.Errorf("Mode %s: expect\n%s, got\n%s.\n", mode, expect, string(bs))
+		}
+	}
+
+	// prices of 3 digits symbol
+	tf := core.NewTimeframe("M1", "USDJPY", NewBars(ModeMT4, "M1", day, day, true, "USDJPY", dest, nil, nil))
+	tf.PackTicks(0, []*core.TickData{{Timestamp: ms + 1000, Ask: 117.625, Bid: 117.615, VolumeBid: 1}})
+	tf.Finish()
+
+	bs, err := ioutil.ReadFile(filepath.Join(dest, "USDJPY-M1-2017-01-02-2017-01-02.CSV"))
+	expect := "date,time,open,high,low,close,volume\n" +
+		"2017.01.02,00:00,117.615,117.615,117.615,117.615,1\n"
+	if err != nil || string(bs) != expect {
+		t.Errorf("Expect\n%s, got\n%s: %v.\n", expect, string(bs), err)
+	}
+}
+
+func TestDumpCsvWeekMonth(t *testing.T) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	defer os.RemoveAll(dest)
+
+	// Friday, Sunday, the last day of January and the first of February
+	ticks := make([]*core.TickData, 0)
+	for idx, at := range []time.Time{
+		time.Date(2017, 1, 27, 10, 0, 0, 0, time.UTC),
+		time.Date(2017, 1, 29, 22, 0, 0, 0, time.UTC),
+		time.Date(2017, 1, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		bid := 1.07000 + float64(idx)*0.001
+		ticks = append(ticks, &core.TickData{Timestamp: at.Unix() * 1000, Ask: bid + 0.0001, Bid: bid, VolumeBid: 1})
+	}
+
+	start, end := time.Date(2017, 1, 27, 0, 0, 0, 0, time.UTC), time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+	for period, expect := range map[string]string{
+		// weeks begin on Sunday
+		"W1": "2017.01.22,00:00,1.07000,1.07000,1.07000,1.07000,1\n" +
+			"2017.01.29,00:00,1.07100,1.07300,1.07100,1.07300,3\n",
+		// months begin on the first day
+		"MN1": "2017.01.01,00:00,1.07000,1.07200,1.07000,1.07200,3\n" +
+			"2017.02.01,00:00,1.07300,1.07300,1.07300,1.07300,1\n",
+	} {
+		tf := core.NewTimeframe(period, "EURUSD", NewBars(ModeMT4, period, start, end, false, "EURUSD", dest, nil, nil))
+		tf.PackTicks(0, ticks)
+		tf.Finish()
+
+		bs, err := ioutil.ReadFile(filepath.Join(dest, fmt.Sprintf("EURUSD-%s-2017-01-27-2017-02-01.CSV", period)))
+		if err != nil || string(bs) != expect {
+			t.Errorf("%s: expect\n%s, got\n%s: %v.\n", period, expect, string(bs), err)
+		}
+	}
+}
+
+func TestCsvWriter(t *testing.T) {
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := []*core.TickData{
+		{Timestamp: day.Unix()*1000 + 1000, Ask: 1.05110, Bid: 1.05100, VolumeAsk: 0.75, VolumeBid: 1},
+		{Timestamp: day.Unix()*1000 + 2000, Ask: 1.05320, Bid: 1.05300, VolumeAsk: 0.75, VolumeBid: 2},
+	}
+
+	var buf bytes.Buffer
+	c := NewWriter(&buf, true, "EURUSD", nil)
+	c.PackTicks(0, ticks)
+	c.Finish()
+
+	expect := "time,ask,bid,ask_volume,bid_volume\n" +
+		"2017-01-02 00:00:01.000,1.05110,1.05100,0.75,1.00\n" +
+		"2017-01-02 00:00:02.000,1.05320,1.05300,0.75,2.00\n"
+	if buf.String() != expect {
+		t.Errorf("Expect\n%s, got\n%s.\n", expect, buf.String())
+	}
+}
+
+func TestDumpCsvPartition(t *testing.T) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	defer os.RemoveAll(dest)
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := make([]*core.TickData, 0)
+	for h := 0; h < 72; h++ {
+		ticks = append(ticks, &core.TickData{
+			Timestamp: day.Add(time.Duration(h)*time.Hour).Unix() * 1000,
+			Ask:       1.05110,
+			Bid:       1.05100,
+		})
+	}
+
+	part, err := NewPartition("day", "gzip")
+	if err != nil {
+		t.Fatalf("Invalid partition: %v.\n", err)
+	}
+	c := New(day, day.Add(72*time.Hour), true, "EURUSD", dest, nil, part)
+	c.PackTicks(0, ticks)
+	c.Finish()
+
+	for _, date := range []string{"2017-01-02", "2017-01-03", "2017-01-04"} {
+		f, err := os.Open(filepath.Join(dest, "EURUSD-"+date+".CSV.gz"))
+		if err != nil {
+			t.Fatalf("Open %s failed: %v.\n", date, err)
+		}
+		defer f.Close()
+
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("Open gzip %s failed: %v.\n", date, err)
+		}
+		bs, _ := ioutil.ReadAll(zr)
+		lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+		if len(lines) != 25 || !strings.HasPrefix(lines[1], date+" 00:00:00.000") {
+			t.Errorf("%s: unexpected content %d lines, %v.\n", date, len(lines), lines[:2])
+		}
+	}
+
+	if _, err := NewPartition("10XB", ""); err == nil {
+		t.Errorf("Expect invalid split error.\n")
+	}
+}
+
+func TestDumpCsvSplitSize(t *testing.T) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	defer os.RemoveAll(dest)
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := make([]*core.TickData, 0, 20000)
+	for idx := 0; idx < cap(ticks); idx++ {
+		bid := 1.05 + float64(idx*7919%1000)*0.00001
+		ticks = append(ticks, &core.TickData{
+			Timestamp: day.Unix()*1000 + int64(idx)*250,
+			Ask:       bid + 0.0001,
+			Bid:       bid,
+			VolumeBid: float64(idx % 13),
+		})
+	}
+
+	const limit = 16 << 10
+	for _, compress := range []string{"", CompressGzip, CompressZstd} {
+		folder := filepath.Join(dest, compress+"size")
+		c := New(day, day, true, "EURUSD", folder, nil, &Partition{Size: limit, Compress: compress})
+		c.PackTicks(0, ticks)
+		c.Finish()
+
+		names, _ := filepath.Glob(filepath.Join(folder, "*"))
+		if len(names) < 3 {
+			t.Fatalf("%s: expect files split by size, got %v.\n", compress, names)
+		}
+		rows := 0
+		for idx, name := range names {
+			info, _ := os.Stat(name)
+			// the last file may be small, the others are close to the limit
+			if info.Size() > limit || (idx < len(names)-1 && info.Size() < limit*3/4) {
+				t.Errorf("%s: unexpected size %d of %s.\n", compress, info.Size(), name)
+			}
+			rows += countRows(t, name, compress) - 1
+		}
+		if rows != len(ticks) {
+			t.Errorf("%s: expect %d rows, got %d.\n", compress, len(ticks), rows)
+		}
+	}
+}
+
+// countRows read the rows of csv file, decompressed by `compress`
+func countRows(t *testing.T, fpath, compress string) int {
+	f, err := os.Open(fpath)
+	if err != nil {
+		t.Fatalf("Open %s failed: %v.\n", fpath, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch compress {
+	case CompressGzip:
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatalf("Open gzip %s failed: %v.\n", fpath, err)
+		}
+	case CompressZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			t.Fatalf("Open zstd %s failed: %v.\n", fpath, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read %s failed: %v.\n", fpath, err)
+	}
+	return strings.Count(string(bs), "\n")
+}
@@ -0,0 +1,238 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
+)
+
+// Column names of csv tick file
+const (
+	ColTime      = "time"
+	ColDate      = "date" // date part only, used together with `time` column
+	ColAsk       = "ask"
+	ColBid       = "bid"
+	ColAskVolume = "ask_volume"
+	ColBidVolume = "bid_volume"
+	ColMid       = "mid"    // (ask + bid) / 2, output only
+	ColSpread    = "spread" // ask - bid in points, output only
+	ColSkip      = "-"      // ignored column
+)
+
+// Time format aliases besides go time layout
+const (
+	TimeUnix    = "unix"    // epoch seconds
+	TimeUnixMs  = "unix_ms" // epoch milliseconds
+	TimeRFC3339 = "rfc3339" // 2006-01-02T15:04:05.000Z07:00
+	TimeMT4     = "mt4"     // 2006.01.02 15:04:05, use with `date,time` columns for MT4 import
+)
+
+var (
+	// DefaultTimeFormat used by CsvDump
+	DefaultTimeFormat = "2006-01-02 15:04:05.000"
+
+	timeAliases = map[string]string{
+		TimeRFC3339: "2006-01-02T15:04:05.000Z07:00",
+		TimeMT4:     "2006.01.02 15:04:05",
+	}
+)
+
+// Layout describe the columns and formats of csv tick file.
+// If both `date` and `time` columns are used, the time format is split at the first space,
+// the date column takes the first part and the time column takes the rest.
+//
+type Layout struct {
+	Columns    []string // column names in order, empty to use the header or default columns
+	Comma      rune     // field delimiter
+	TimeFormat string   // go time layout, or one of `unix`, `unix_ms`
+	Digits     int      // price digits after decimal point, 0 to derive from symbol
+}
+
+// NewLayout create csv layout from command line values,
+// `columns` is comma separated column names like: time,bid,ask,-,-
+//
+func NewLayout(columns, delimiter, timeFormat string) (*Layout, error) {
+	l := &Layout{
+		Comma:      ',',
+		TimeFormat: DefaultTimeFormat,
+	}
+
+	if columns != "" {
+		for _, col := range strings.Split(columns, ",") {
+			col = strings.ToLower(strings.TrimSpace(col))
+			if !validColumn(col) {
+				return nil, fmt.Errorf("invalid csv column: %s", col)
+			}
+			l.Columns = append(l.Columns, col)
+		}
+	}
+
+	switch delimiter {
+	case "":
+		break
+	case "\\t", "tab":
+		l.Comma = '\t'
+	default:
+		if len([]rune(delimiter)) != 1 {
+			return nil, fmt.Errorf("invalid csv delimiter: %s", delimiter)
+		}
+		l.Comma = []rune(delimiter)[0]
+	}
+
+	if timeFormat != "" {
+		l.TimeFormat = timeFormat
+		if format, ok := timeAliases[strings.ToLower(timeFormat)]; ok {
+			l.TimeFormat = format
+		}
+	}
+
+	if l.hasColumn(ColDate) {
+		if l.TimeFormat == TimeUnix || l.TimeFormat == TimeUnixMs {
+			return nil, errors.New("date column can't be used with epoch time format")
+		}
+		if !strings.Contains(l.TimeFormat, " ") {
+			return nil, fmt.Errorf("time format %s can't be split into date and time", l.TimeFormat)
+		}
+	}
+	return l, nil
+}
+
+func validColumn(col string) bool {
+	switch col {
+	case ColTime, ColDate, ColAsk, ColBid, ColAskVolume, ColBidVolume, ColMid, ColSpread, ColSkip:
+		return true
+	}
+	return false
+}
+
+func (l *Layout) hasColumn(col string) bool {
+	for _, c := range l.Columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// header return the column names to write, the default columns if not given
+func (l *Layout) header() []string {
+	if len(l.Columns) == 0 {
+		return csvHeader
+	}
+	return l.Columns
+}
+
+// parseTime convert the time column value into timestamp in milliseconds
+func (l *Layout) parseTime(s string) (int64, error) {
+	switch l.TimeFormat {
+	case TimeUnix, TimeUnixMs:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		if l.TimeFormat == TimeUnix {
+			v = v * 1000
+		}
+		return int64(v + 0.5), nil
+	}
+
+	tm, err := time.ParseInLocation(l.TimeFormat, s, time.UTC)
+	if err != nil {
+		return 0, err
+	}
+	return tm.UnixNano() / int64(time.Millisecond), nil
+}
+
+// formatTime convert timestamp in milliseconds into date and time column values
+func (l *Layout) formatTime(timestamp int64) (string, string) {
+	switch l.TimeFormat {
+	case TimeUnix:
+		return "", strconv.FormatFloat(float64(timestamp)/1000, 'f', 3, 64)
+	case TimeUnixMs:
+		return "", strconv.FormatInt(timestamp, 10)
+	}
+
+	tm := time.Unix(timestamp/1000, (timestamp%1000)*int64(time.Millisecond)).UTC()
+	if l.hasColumn(ColDate) {
+		// 2006.01.02 15:04:05 => [2006.01.02 15:04:05]
+		ss := strings.SplitN(l.TimeFormat, " ", 2)
+		return tm.Format(ss[0]), tm.Format(ss[1])
+	}
+	return "", tm.Format(l.TimeFormat)
+}
+
+// barHeader return the column names of bar row
+func (l *Layout) barHeader() []string {
+	if l.hasColumn(ColDate) {
+		return append([]string{ColDate}, barHeader...)
+	}
+	return barHeader
+}
+
+// BarStrings format bar into csv row by layout time format,
+// columns are: [date,] time, open, high, low, close, volume, spread, ticks
+//
+func (l *Layout) BarStrings(bar *hst.BarData, ticks int, digits int) []string {
+	var (
+		row      = make([]string, 0, len(barHeader)+1)
+		date, tm = l.formatTime(int64(bar.CTM) * 1000)
+		priceFmt = fmt.Sprintf("%%.%df", digits)
+	)
+
+	if l.hasColumn(ColDate) {
+		row = append(row, date)
+	}
+	return append(row,
+		tm,
+		fmt.Sprintf(priceFmt, bar.Open),
+		fmt.Sprintf(priceFmt, bar.High),
+		fmt.Sprintf(priceFmt, bar.Low),
+		fmt.Sprintf(priceFmt, bar.Close),
+		strconv.FormatUint(bar.Volume, 10),
+		strconv.FormatUint(uint64(bar.Spread), 10),
+		strconv.Itoa(ticks),
+	)
+}
+
+// Strings format tick into csv row by layout, `digits` is the price precision
+//
+func (l *Layout) Strings(tick *core.TickData, digits int) []string {
+	var (
+		columns   = l.header()
+		row       = make([]string, 0, len(columns))
+		date, tm  = l.formatTime(tick.Timestamp)
+		priceFmt  = fmt.Sprintf("%%.%df", digits)
+		midFmt    = fmt.Sprintf("%%.%df", digits+1)
+		pointSize = math.Pow10(-digits)
+	)
+
+	for _, col := range columns {
+		switch col {
+		case ColDate:
+			row = append(row, date)
+		case ColTime:
+			row = append(row, tm)
+		case ColAsk:
+			row = append(row, fmt.Sprintf(priceFmt, tick.Ask))
+		case ColBid:
+			row = append(row, fmt.Sprintf(priceFmt, tick.Bid))
+		case ColAskVolume:
+			row = append(row, fmt.Sprintf("%.2f", tick.VolumeAsk))
+		case ColBidVolume:
+			row = append(row, fmt.Sprintf("%.2f", tick.VolumeBid))
+		case ColMid:
+			row = append(row, fmt.Sprintf(midFmt, (tick.Ask+tick.Bid)/2))
+		case ColSpread:
+			row = append(row, fmt.Sprintf("%.1f", (tick.Ask-tick.Bid)/pointSize))
+		default:
+			row = append(row, "")
+		}
+	}
+	return row
+}
@@ -0,0 +1,220 @@
+package csv
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Split periods of csv output
+const (
+	SplitDay   = "day"
+	SplitWeek  = "week"
+	SplitMonth = "month"
+)
+
+// Compression of csv output
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// Partition describe how csv output is split into files and compressed.
+//
+// File names are:
+//
+//	SYMBOL[-PERIOD]-START-END.CSV         no split
+//	SYMBOL[-PERIOD]-2017-01-02.CSV        split by day
+//	SYMBOL[-PERIOD]-2017-W01.CSV          split by ISO week
+//	SYMBOL[-PERIOD]-2017-01.CSV           split by month
+//
+// a sequence number like `-001` is inserted before the extension if split by size,
+// and `.gz` or `.zst` is appended if compressed.
+//
+type Partition struct {
+	Period   string // day, week, month or empty
+	Size     int64  // max bytes of each file, 0 for no limit
+	Compress string // gzip, zstd or empty
+}
+
+// NewPartition parse command line values, `split` is one of day/week/month or size like 100MB, 1GB
+//
+func NewPartition(split, compress string) (*Partition, error) {
+	p := &Partition{}
+
+	split = strings.ToLower(strings.TrimSpace(split))
+	switch split {
+	case "":
+		break
+	case SplitDay, SplitWeek, SplitMonth:
+		p.Period = split
+	default:
+		unit := int64(1 << 20)
+		switch {
+		case strings.HasSuffix(split, "gb"):
+			unit = 1 << 30
+			split = strings.TrimSuffix(split, "gb")
+		case strings.HasSuffix(split, "mb"):
+			split = strings.TrimSuffix(split, "mb")
+		}
+		n, err := strconv.ParseInt(split, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid csv split value: %s", split)
+		}
+		p.Size = n * unit
+	}
+
+	switch compress = strings.ToLower(compress); compress {
+	case "", CompressGzip, CompressZstd:
+		p.Compress = compress
+	default:
+		return nil, fmt.Errorf("invalid csv compression: %s", compress)
+	}
+	return p, nil
+}
+
+// key return the partition key of timestamp in milliseconds
+func (p *Partition) key(timestamp int64) string {
+	tm := time.Unix(timestamp/1000, 0).UTC()
+	switch p.Period {
+	case SplitDay:
+		return tm.Format("2006-01-02")
+	case SplitWeek:
+		year, week := tm.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case SplitMonth:
+		return tm.Format("2006-01")
+	}
+	return ""
+}
+
+// fileName build the file name of partition `key`, `seq` starts from 1
+func (p *Partition) fileName(prefix, key string, seq int) string {
+	name := prefix + "-" + key
+	if p.Size > 0 {
+		name = fmt.Sprintf("%s-%03d", name, seq)
+	}
+	name = name + "." + ext
+
+	switch p.Compress {
+	case CompressGzip:
+		name += ".gz"
+	case CompressZstd:
+		name += ".zst"
+	}
+	return name
+}
+
+// countWriter count bytes written to file
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// trailerBytes is more than the bytes written by Close of compressor after flushed
+const trailerBytes = 64
+
+// partFile is one output file of partition
+type partFile struct {
+	fpath string
+	key   string
+	f     io.WriteCloser
+	cw    *countWriter
+	zw    io.WriteCloser
+	w     *csv.Writer
+	rows  int
+	check int // rows of next size check
+}
+
+// openPart create the output and the compressor
+func (p *Partition) openPart(dst core.Destination, fpath, key string, comma rune) (*partFile, error) {
+	f, err := dst.Create(fpath)
+	if err != nil {
+		log.Error("Failed to create file %s, error %v.", fpath, err)
+		return nil, err
+	}
+
+	part := &partFile{
+		fpath: fpath,
+		key:   key,
+		f:     f,
+		cw:    &countWriter{w: f},
+		check: 16,
+	}
+
+	var w io.Writer = part.cw
+	switch p.Compress {
+	case CompressGzip:
+		part.zw = gzip.NewWriter(part.cw)
+		w = part.zw
+	case CompressZstd:
+		if part.zw, err = zstd.NewWriter(part.cw); err != nil {
+			f.Close()
+			log.Error("Create zstd writer %s failed: %v.", fpath, err)
+			return nil, err
+		}
+		w = part.zw
+	}
+
+	part.w = csv.NewWriter(w)
+	part.w.Comma = comma
+	return part, nil
+}
+
+// full check if the file can't take more rows within the size limit. The csv writer and compressor
+// are flushed at each check, so the real bytes of file are counted. The rows until next check are
+// estimated by the average bytes of row, at most 1024, so the file only exceeds the limit if some rows
+// are more than twice of the average.
+func (p *partFile) full(limit int64) bool {
+	if p.rows++; limit <= 0 || p.rows <= p.check {
+		return false
+	}
+
+	p.w.Flush()
+	if zw, ok := p.zw.(interface{ Flush() error }); ok {
+		zw.Flush()
+	}
+	avg := p.cw.n/int64(p.rows-1) + 1
+	rows := (limit - p.cw.n - trailerBytes) / avg / 2
+	if rows <= 0 {
+		return true
+	}
+	if rows > 1024 {
+		rows = 1024
+	}
+	p.check = p.rows + int(rows) - 1
+	return false
+}
+
+// Close flush csv writer and compressor, then close the file
+func (p *partFile) Close() error {
+	p.w.Flush()
+	err := p.w.Error()
+	if p.zw != nil {
+		if e := p.zw.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := p.f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		log.Error("Close csv %s failed: %v.", p.fpath, err)
+	} else {
+		log.Trace("Saved file %s => %d.", p.fpath, p.cw.n)
+	}
+	return err
+}
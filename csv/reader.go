@@ -0,0 +1,203 @@
+package csv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// TickReader read tick data from csv file, the default layout is the same as CsvDump writes
+//
+type TickReader struct {
+	fpath  string
+	symbol string
+	layout Layout
+	index  map[string]int
+	line   int
+	f      *os.File
+	r      *csv.Reader
+}
+
+// NewReader open csv file `fpath` as tick data source of `symbol`.
+// If the first row is header and `layout.Columns` is empty, columns are mapped by the header names.
+//
+func NewReader(fpath, symbol string, layout *Layout) (*TickReader, error) {
+	f, err := os.OpenFile(fpath, os.O_RDONLY, 666)
+	if err != nil {
+		log.Error("Open csv file %s failed: %v.", fpath, err)
+		return nil, err
+	}
+
+	if layout == nil {
+		layout, _ = NewLayout("", "", "")
+	}
+
+	r := csv.NewReader(f)
+	r.Comma = layout.Comma
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	return &TickReader{
+		fpath:  fpath,
+		symbol: symbol,
+		layout: *layout,
+		f:      f,
+		r:      r,
+	}, nil
+}
+
+// Close the csv file
+//
+func (t *TickReader) Close() error {
+	return t.f.Close()
+}
+
+// Read next tick data, return io.EOF at the end of file
+//
+func (t *TickReader) Read() (*core.TickData, error) {
+	for {
+		record, err := t.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		t.line++
+
+		if t.index == nil {
+			if t.mapColumns(record) {
+				// header row
+				continue
+			}
+		}
+
+		tick, err := t.parseRecord(record)
+		if err != nil {
+			err = fmt.Errorf("%s line %d: %v", t.fpath, t.line, err)
+		}
+		return tick, err
+	}
+}
+
+// mapColumns build column index by layout or header row, return true if `record` is header
+func (t *TickReader) mapColumns(record []string) bool {
+	header := true
+	for _, field := range record {
+		if !validColumn(strings.ToLower(strings.TrimSpace(field))) {
+			header = false
+			break
+		}
+	}
+
+	columns := t.layout.Columns
+	if len(columns) == 0 {
+		if header {
+			columns = make([]string, 0, len(record))
+			for _, field := range record {
+				columns = append(columns, strings.ToLower(strings.TrimSpace(field)))
+			}
+		} else {
+			columns = csvHeader
+		}
+	}
+
+	t.index = make(map[string]int)
+	for idx, col := range columns {
+		if col != ColSkip {
+			t.index[col] = idx
+		}
+	}
+	return header
+}
+
+// parseRecord convert csv fields into tick data
+func (t *TickReader) parseRecord(record []string) (*core.TickData, error) {
+	field := func(col string) (string, bool) {
+		idx, ok := t.index[col]
+		if !ok || idx >= len(record) {
+			return "", false
+		}
+		return strings.TrimSpace(record[idx]), true
+	}
+
+	var (
+		err  error
+		tick = &core.TickData{Symbol: t.symbol}
+	)
+
+	// time, or date + time
+	tm, ok := field(ColTime)
+	if !ok {
+		return nil, errors.New("missing time column")
+	}
+	if date, ok := field(ColDate); ok {
+		tm = date + " " + tm
+	}
+	if tick.Timestamp, err = t.layout.parseTime(tm); err != nil {
+		return nil, fmt.Errorf("invalid time %s: %v", tm, err)
+	}
+
+	// prices are required
+	for _, c := range []struct {
+		col string
+		val *float64
+	}{
+		{ColAsk, &tick.Ask},
+		{ColBid, &tick.Bid},
+	} {
+		s, ok := field(c.col)
+		if !ok {
+			return nil, fmt.Errorf("missing %s column", c.col)
+		}
+		if *c.val, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("invalid %s %s", c.col, s)
+		}
+	}
+
+	// volumes are optional
+	for _, c := range []struct {
+		col string
+		val *float64
+	}{
+		{ColAskVolume, &tick.VolumeAsk},
+		{ColBidVolume, &tick.VolumeBid},
+	} {
+		if s, ok := field(c.col); ok && s != "" {
+			if *c.val, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s %s", c.col, s)
+			}
+		}
+	}
+
+	return tick, nil
+}
+
+// ReadAll read all the left ticks
+//
+func (t *TickReader) ReadAll() ([]*core.TickData, error) {
+	ticks := make([]*core.TickData, 0, 1024)
+	for {
+		tick, err := t.Read()
+		if err == io.EOF {
+			return ticks, nil
+		}
+		if err != nil {
+			return ticks, err
+		}
+		ticks = append(ticks, tick)
+	}
+}
+
+// NewSource create a tick data source from csv file
+//
+func NewSource(fpath string, layout *Layout) (core.Source, error) {
+	r, err := NewReader(fpath, "", layout)
+	if err != nil {
+		return nil, err
+	}
+	return core.NewReaderSource(r), nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -10,17 +11,28 @@ import (
 	"sync"
 	"time"
 
+	"github.com/adyzng/go-duka/arrow"
 	"github.com/adyzng/go-duka/bi5"
 	"github.com/adyzng/go-duka/core"
 	"github.com/adyzng/go-duka/csv"
 	"github.com/adyzng/go-duka/fxt4"
 	"github.com/adyzng/go-duka/hst"
+	"github.com/adyzng/go-duka/influx"
+	"github.com/adyzng/go-duka/jsonl"
 	"github.com/adyzng/go-duka/misc"
+	"github.com/adyzng/go-duka/parquet"
+	"github.com/adyzng/go-duka/sqlite"
 )
 
 var (
 	log             = misc.NewLogger("App", 2)
-	supportsFormats = []string{"csv", "fxt", "hst"}
+	supportsFormats = []string{"csv", "fxt", "hst", "parquet", "arrow", "sqlite", "jsonl", "influx"}
+	supportsSources = []string{"dukascopy", "bi5", "csv", "hst"}
+	// line based formats and their file extension, which can share stdout
+	lineFormats = map[string]string{"jsonl": "jsonl", "influx": "lp"}
+
+	// stdout is shared by all the outputs
+	stdout = misc.NewSyncWriter(os.Stdout)
 )
 
 // DukaApp used to download source tick data
@@ -33,16 +45,30 @@ type DukaApp struct {
 // AppOption download options
 //
 type AppOption struct {
-	Start     time.Time
-	End       time.Time
-	Symbol    string
-	Format    string
-	Folder    string
-	Periods   string
-	Spread    uint32
-	Mode      uint32
-	Local     bool
-	CsvHeader bool
+	Start      time.Time
+	End        time.Time
+	Symbol     string
+	Format     string
+	Folder     string
+	Source     string
+	Input      string
+	Periods    string
+	Spread     uint32
+	Mode       uint32
+	Local      bool
+	Stdout     bool
+	Bars       bool
+	Update     bool
+	CsvHeader  bool
+	InLayout   *csv.Layout
+	CsvLayout  *csv.Layout
+	CsvMode    string
+	CsvPart    *csv.Partition
+	ParquetOpt *parquet.Option
+	HstOpt     *hst.Option
+	FxtOpt     *fxt4.Option
+	SQLiteDB   string
+	Markup     *core.Markup
 }
 
 // ParseOption parse input command line
@@ -52,6 +78,8 @@ func ParseOption(args argsList) (*AppOption, error) {
 	opt := AppOption{
 		CsvHeader: args.Header,
 		Local:     args.Local,
+		Bars:      args.Bars,
+		Update:    args.Update,
 		Format:    args.Format,
 		Symbol:    strings.ToUpper(args.Symbol),
 		Spread:    uint32(args.Spread),
@@ -89,6 +117,14 @@ func ParseOption(args argsList) (*AppOption, error) {
 		err = fmt.Errorf("invalid end parameter which shouldn't early then start")
 		return nil, err
 	}
+	if args.Output == "-" {
+		if opt.Format == "sqlite" {
+			err = fmt.Errorf("stdout is not supported by %s format", opt.Format)
+			return nil, err
+		}
+		// bi5 files are still cached in current folder
+		opt.Stdout, args.Output = true, "."
+	}
 	if opt.Folder, err = filepath.Abs(args.Output); err != nil {
 		err = fmt.Errorf("invalid destination folder")
 		return nil, err
@@ -98,6 +134,85 @@ func ParseOption(args argsList) (*AppOption, error) {
 		return nil, err
 	}
 
+	// check source, guess from input file if not given
+	{
+		source := strings.ToLower(args.Source)
+		if source == "" {
+			source = "dukascopy"
+			if args.Input != "" {
+				if fi, err := os.Stat(args.Input); err == nil && fi.IsDir() {
+					source = "bi5"
+				} else {
+					source = strings.ToLower(strings.TrimPrefix(filepath.Ext(args.Input), "."))
+				}
+			}
+		}
+
+		bSupport := false
+		for _, ssource := range supportsSources {
+			if source == ssource {
+				bSupport = true
+				break
+			}
+		}
+		if !bSupport {
+			err = fmt.Errorf("not supported source: %s", source)
+			return nil, err
+		}
+		opt.Source = source
+	}
+	if opt.Source != "dukascopy" {
+		if args.Input == "" {
+			err = fmt.Errorf("input is required by %s source", opt.Source)
+			return nil, err
+		}
+		if opt.Input, err = filepath.Abs(args.Input); err != nil {
+			err = fmt.Errorf("invalid input file")
+			return nil, err
+		}
+		if _, err = os.Stat(opt.Input); err != nil {
+			err = fmt.Errorf("invalid input file: %v", err)
+			return nil, err
+		}
+	}
+	if opt.Source == "csv" {
+		if opt.InLayout, err = csv.NewLayout(args.InColumns, args.InDelim, args.InTimeFmt); err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.Format == "csv" {
+		switch opt.CsvMode = strings.ToLower(args.CsvMode); opt.CsvMode {
+		case "":
+			opt.CsvMode = csv.ModeTicks
+		case csv.ModeTicks, csv.ModeBars, csv.ModeMT4:
+			break
+		default:
+			err = fmt.Errorf("invalid csv mode: %s", args.CsvMode)
+			return nil, err
+		}
+		if opt.CsvLayout, err = csv.NewLayout(args.CsvColumns, args.CsvDelim, args.CsvTimeFmt); err != nil {
+			return nil, err
+		}
+		if opt.CsvPart, err = csv.NewPartition(args.CsvSplit, args.CsvCompress); err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.Format == "parquet" {
+		opt.ParquetOpt, err = parquet.NewOption(args.PqUnit, args.PqCompress, args.PqRowGroup, args.PqExtra)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.Format == "sqlite" {
+		opt.SQLiteDB = args.SQLiteDB
+		if !filepath.IsAbs(opt.SQLiteDB) {
+			opt.SQLiteDB = filepath.Join(opt.Folder, opt.SQLiteDB)
+		}
+	}
+
 	if args.Period != "" {
 		args.Period = strings.ToUpper(args.Period)
 		if !core.TimeframeRegx.MatchString(args.Period) {
@@ -107,30 +222,363 @@ func ParseOption(args argsList) (*AppOption, error) {
 		opt.Periods = args.Period
 	}
 
+	if opt.Source == "hst" {
+		if err = checkHstSource(&opt); err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.Format == "fxt" {
+		if opt.FxtOpt, err = fxt4.NewOption(opt.Mode, opt.Spread, args.FxtSpread, args.FxtSplit); err != nil {
+			return nil, err
+		}
+		if opt.FxtOpt.Spec, err = loadFxtSpec(args, opt.Symbol); err != nil {
+			return nil, err
+		}
+		// tester dates are the given dates, the ticks are loaded from the prolog days before
+		opt.FxtOpt.From = uint32(opt.Start.Unix())
+		opt.FxtOpt.To = uint32(opt.End.Add(-24 * time.Hour).Unix())
+		opt.Start = opt.Start.AddDate(0, 0, -int(args.FxtProlog))
+
+		if args.TestExpert != "" {
+			if opt.FxtOpt.Tester, err = fxt4.NewTester(args.TestExpert, args.TestInputs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if args.TestExpert != "" && opt.Format != "fxt" {
+		err = fmt.Errorf("tester ini is only supported by fxt format")
+		return nil, err
+	}
+
+	if opt.Format == "hst" {
+		if opt.HstOpt, err = hst.NewOption(uint32(args.HstVersion), args.HstSpread, opt.Spread); err != nil {
+			return nil, err
+		}
+		if args.SymbolsRaw != "" {
+			sym, err := fxt4.FindSymbol(args.SymbolsRaw, opt.Symbol)
+			if err != nil {
+				return nil, err
+			}
+			opt.HstOpt.Digits = sym.Digits
+		}
+	}
+
+	if opt.Update && (opt.Format != "hst" || opt.Stdout) {
+		err = fmt.Errorf("update is only supported by hst format saved into folder")
+		return nil, err
+	}
+
+	if opt.Stdout {
+		if _, ok := lineFormats[opt.Format]; !ok && opt.barsOutput() && strings.Contains(opt.Periods, ",") {
+			err = fmt.Errorf("only one timeframe can be written to stdout by %s format", opt.Format)
+			return nil, err
+		}
+		if opt.CsvPart != nil && *opt.CsvPart != (csv.Partition{}) {
+			err = fmt.Errorf("csv split and compress are not supported by stdout")
+			return nil, err
+		}
+		if opt.FxtOpt != nil && (opt.FxtOpt.Split != "" || opt.FxtOpt.SplitSize > 0 || opt.FxtOpt.Tester != nil) {
+			err = fmt.Errorf("fxt split and tester ini are not supported by stdout")
+			return nil, err
+		}
+	}
+
+	if args.Markup != 0 || args.MarkupPct != 0 || args.Commission != 0 || args.MarkupTime != "" {
+		schedule, err := core.ParseMarkupSchedule(args.MarkupTime)
+		if err != nil {
+			return nil, err
+		}
+		opt.Markup, err = core.NewMarkup(opt.Symbol, args.MarkupSide, args.Markup, args.MarkupPct, args.Commission, schedule)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &opt, nil
 }
 
+// loadFxtSpec load the contract specification of fxt header from symbols.raw, spec file and `key=value` overrides,
+// the later ones take precedence.
+//
+func loadFxtSpec(args argsList, symbol string) (*fxt4.Spec, error) {
+	var err error
+	spec := fxt4.NewSpec(symbol)
+	for _, fpath := range []string{args.SymbolsRaw, args.FxtSpec} {
+		if fpath == "" {
+			continue
+		}
+		if err = spec.Load(fpath, symbol); err != nil {
+			return nil, err
+		}
+	}
+	for _, kv := range args.FxtSet {
+		if err = spec.Set(kv); err != nil {
+			return nil, err
+		}
+	}
+	if err = spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fxt spec of %s: %v", symbol, err)
+	}
+	return spec, nil
+}
+
+// checkHstSource check the symbol of hst source, and the timeframes can be aggregated from its bars
+//
+func checkHstSource(opt *AppOption) error {
+	r, err := hst.NewReader(opt.Input)
+	if err != nil {
+		return err
+	}
+	header := *r.Header()
+	r.Close()
+
+	if symbol := header.SymbolName(); symbol != opt.Symbol {
+		return fmt.Errorf("hst symbol %s doesn't match %s", symbol, opt.Symbol)
+	}
+	for _, period := range strings.Split(opt.Periods, ",") {
+		timeframe, name := core.ParseTimeframe(strings.Trim(period, " \t\r\n"))
+		if timeframe < header.Period || timeframe%header.Period != 0 {
+			return fmt.Errorf("timeframe %s can't be aggregated from hst period %d", name, header.Period)
+		}
+	}
+	return nil
+}
+
+// ConvertHst aggregate the bars of hst file `args.Convert` into higher timeframes,
+// which are saved as hst files into output folder. The symbol is read from the hst header.
+//
+func ConvertHst(args argsList) error {
+	var err error
+	opt := AppOption{
+		Format: "hst",
+		Update: args.Update,
+		Spread: uint32(args.Spread),
+	}
+
+	if opt.Folder, err = filepath.Abs(args.Output); err != nil || args.Output == "-" {
+		return fmt.Errorf("invalid destination folder")
+	}
+	if err = os.MkdirAll(opt.Folder, 666); err != nil {
+		return fmt.Errorf("create destination folder failed: %v", err)
+	}
+	if opt.HstOpt, err = hst.NewOption(uint32(args.HstVersion), args.HstSpread, opt.Spread); err != nil {
+		return err
+	}
+	if opt.Periods = strings.ToUpper(args.Period); !core.TimeframeRegx.MatchString(opt.Periods) {
+		return fmt.Errorf("invalid timeframe value: %s", args.Period)
+	}
+
+	r, err := hst.NewReader(args.Convert)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	opt.Symbol = r.Header().SymbolName()
+	opt.HstOpt.Digits = r.Header().Digits
+
+	timeframes := make([]uint32, 0)
+	for _, period := range strings.Split(opt.Periods, ",") {
+		timeframe, name := core.ParseTimeframe(strings.Trim(period, " \t\r\n"))
+		if hp := r.Header().Period; timeframe < hp || timeframe%hp != 0 {
+			return fmt.Errorf("timeframe %s can't be aggregated from hst period %d", name, hp)
+		}
+		timeframes = append(timeframes, timeframe)
+	}
+
+	outs := make([]*hst.HST401, 0)
+	for _, timeframe := range timeframes {
+		if !opt.Update {
+			outs = append(outs, hst.NewHST(timeframe, opt.Symbol, opt.Folder, opt.HstOpt))
+			continue
+		}
+
+		fpath := filepath.Join(opt.Folder, hst.FileName(opt.Symbol, timeframe))
+		f, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 666)
+		if err != nil {
+			for _, out := range outs {
+				out.Finish()
+			}
+			return err
+		}
+		defer f.Close()
+		outs = append(outs, hst.NewUpdate(f, timeframe, opt.Symbol, opt.HstOpt))
+	}
+
+	return hst.Convert(r, outs...)
+}
+
+// closeOutput close the output stream after the converter finished
+//
+type closeOutput struct {
+	core.Converter
+	c io.Closer
+}
+
+func (o *closeOutput) Finish() error {
+	err := o.Converter.Finish()
+	if e := o.c.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// barsOutput check if one output is created per timeframe, otherwise the ticks are saved once
+//
+func (opt *AppOption) barsOutput() bool {
+	switch opt.Format {
+	case "hst", "fxt":
+		return true
+	case "csv":
+		return opt.CsvMode != csv.ModeTicks
+	}
+	return opt.Bars
+}
+
+// outputName of single stream output of timeframe `period`
+//
+func outputName(opt *AppOption, timeframe uint32, period string) string {
+	if !opt.barsOutput() {
+		period = ""
+	}
+
+	switch opt.Format {
+	case "hst":
+		return hst.FileName(opt.Symbol, timeframe)
+	case "fxt":
+		return fxt4.FileName(opt.Symbol, timeframe, opt.Mode)
+	case "arrow":
+		return arrow.FileName(opt.Symbol, period, opt.Start, opt.End)
+	}
+
+	// SYMBOL[-PERIOD]-START-END.EXT
+	name := opt.Symbol
+	if period != "" {
+		name += "-" + period
+	}
+	return fmt.Sprintf("%s-%s-%s.%s", name, opt.Start.Format("2006-01-02"), opt.End.Format("2006-01-02"), lineFormats[opt.Format])
+}
+
+// newEncoder create converter which encode into one stream created by `dst`
+//
+func newEncoder(opt *AppOption, dst core.Destination, timeframe uint32, period string) (core.Converter, error) {
+	w, err := dst.Create(outputName(opt, timeframe, period))
+	if err != nil {
+		return nil, err
+	}
+
+	var out core.Converter
+	bars := opt.barsOutput()
+	switch opt.Format {
+	case "csv":
+		if bars {
+			out = csv.NewBarsWriter(w, opt.CsvMode, period, opt.CsvHeader, opt.Symbol, opt.CsvLayout)
+		} else {
+			out = csv.NewWriter(w, opt.CsvHeader, opt.Symbol, opt.CsvLayout)
+		}
+	case "hst":
+		out = hst.NewWriter(w, timeframe, opt.Symbol, opt.HstOpt)
+	case "fxt":
+		out = fxt4.NewWriter(w, timeframe, opt.Symbol, opt.FxtOpt)
+	case "parquet":
+		if bars {
+			out = parquet.NewBarsWriter(w, period, opt.Symbol, opt.ParquetOpt)
+		} else {
+			out = parquet.NewWriter(w, opt.Symbol, opt.ParquetOpt)
+		}
+	case "arrow":
+		if bars {
+			out = arrow.NewBars(w, period, opt.Start, opt.End, opt.Symbol)
+		} else {
+			out = arrow.New(w, opt.Start, opt.End, opt.Symbol)
+		}
+	case "jsonl":
+		if bars {
+			out = jsonl.NewBars(w, period, opt.Symbol)
+		} else {
+			out = jsonl.New(w, opt.Symbol)
+		}
+	case "influx":
+		if bars {
+			out = influx.NewBars(w, period, opt.Symbol)
+		} else {
+			out = influx.New(w, opt.Symbol)
+		}
+	default:
+		w.Close()
+		return nil, fmt.Errorf("unsupported format %s", opt.Format)
+	}
+	return &closeOutput{out, w}, nil
+}
+
 // NewOutputs create timeframe instance
 //
+// The file naming is done here, converters only encode into the streams created by destination,
+// which is the output folder or stdout. Csv, parquet and split fxt files are named by their own partition
+// when saved into folder, and so are fxt files with tester ini.
+//
 func NewOutputs(opt *AppOption) []core.Converter {
+	dst := core.NewFolder(opt.Folder)
+	if opt.Stdout {
+		dst = core.NewWriterDest(stdout)
+	}
+
 	outs := make([]core.Converter, 0)
+	// finish the outputs created so far, so their files are closed on error
+	fail := func() []core.Converter {
+		for _, out := range outs {
+			out.Finish()
+		}
+		return nil
+	}
+
 	for _, period := range strings.Split(opt.Periods, ",") {
-		var format core.Converter
-		timeframe, _ := core.ParseTimeframe(strings.Trim(period, " \t\r\n"))
+		var (
+			err    error
+			format core.Converter
+		)
+		timeframe, name := core.ParseTimeframe(strings.Trim(period, " \t\r\n"))
+
+		// ticks are the same for all the timeframes
+		if !opt.barsOutput() && len(outs) > 0 {
+			continue
+		}
 
-		switch opt.Format {
-		case "csv":
-			format = csv.New(opt.Start, opt.End, opt.CsvHeader, opt.Symbol, opt.Folder)
-			break
-		case "fxt":
-			format = fxt4.NewFxtFile(timeframe, opt.Spread, opt.Mode, opt.Folder, opt.Symbol)
-			break
-		case "hst":
-			format = hst.NewHST(timeframe, opt.Spread, opt.Symbol, opt.Folder)
-			break
+		switch {
+		case opt.Format == "csv" && !opt.Stdout:
+			if opt.CsvMode == csv.ModeTicks {
+				format = csv.New(opt.Start, opt.End, opt.CsvHeader, opt.Symbol, opt.Folder, opt.CsvLayout, opt.CsvPart)
+			} else {
+				format = csv.NewBars(opt.CsvMode, name, opt.Start, opt.End, opt.CsvHeader, opt.Symbol, opt.Folder, opt.CsvLayout, opt.CsvPart)
+			}
+		case opt.Format == "parquet" && !opt.Stdout:
+			if opt.Bars {
+				format = parquet.NewBars(name, opt.Symbol, opt.Folder, opt.ParquetOpt)
+			} else {
+				format = parquet.New(opt.Symbol, opt.Folder, opt.ParquetOpt)
+			}
+		case opt.Format == "fxt" && (opt.FxtOpt.Split != "" || opt.FxtOpt.SplitSize > 0 || opt.FxtOpt.Tester != nil):
+			format = fxt4.NewFxtFile(timeframe, opt.Symbol, opt.Folder, opt.FxtOpt)
+		case opt.Format == "hst" && opt.Update:
+			fpath := filepath.Join(opt.Folder, hst.FileName(opt.Symbol, timeframe))
+			f, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 666)
+			if err != nil {
+				log.Error("Open %s failed: %v.", fpath, err)
+				return fail()
+			}
+			format = &closeOutput{hst.NewUpdate(f, timeframe, opt.Symbol, opt.HstOpt), f}
+		case opt.Format == "sqlite":
+			if opt.Bars {
+				format = sqlite.NewBars(opt.SQLiteDB, name, opt.Symbol)
+			} else {
+				format = sqlite.New(opt.SQLiteDB, opt.Symbol)
+			}
 		default:
-			log.Error("unsupported format %s.", opt.Format)
-			return nil
+			if format, err = newEncoder(opt, dst, timeframe, name); err != nil {
+				log.Error("Create %s output failed: %v.", opt.Format, err)
+				return fail()
+			}
 		}
 
 		outs = append(outs, core.NewTimeframe(period, opt.Symbol, format))
@@ -147,13 +595,25 @@ func NewApp(opt *AppOption) *DukaApp {
 	}
 }
 
-type hReader struct {
-	Bi5  *bi5.Bi5
-	DayH time.Time
-	Data []byte
+// NewSource create tick data source by input arguments
+//
+func NewSource(opt *AppOption) (core.Source, error) {
+	switch opt.Source {
+	case "csv":
+		return csv.NewSource(opt.Input, opt.InLayout)
+	case "hst":
+		return hst.NewSource(opt.Input, opt.Spread)
+	case "bi5":
+		return bi5.NewSource(opt.Input, bi5.ModeCache), nil
+	default:
+		if opt.Local {
+			return bi5.NewSource(opt.Folder, bi5.ModeLocal), nil
+		}
+		return bi5.NewSource(opt.Folder, bi5.ModeDownload), nil
+	}
 }
 
-// Execute download source bi5 tick data from dukascopy
+// Execute load source tick data and convert to output format
 //
 func (app *DukaApp) Execute() error {
 	var (
@@ -176,25 +636,34 @@ func (app *DukaApp) Execute() error {
 			return err
 		}
 	}
+	if opt.FxtOpt != nil && opt.FxtOpt.Tester != nil {
+		if err = saveTesterSet(opt.Folder, opt.FxtOpt.Tester); err != nil {
+			return err
+		}
+	}
+
+	source, err := NewSource(&opt)
+	if err != nil {
+		log.Error("Create %s source failed: %v.", opt.Source, err)
+		return err
+	}
+	defer source.Close()
 
 	//
-	// 按天下载，每天24小时的数据由24个goroutine并行下载
+	// 按天读取，解析，存储
 	//
 	for day := opt.Start; day.Unix() < opt.End.Unix(); day = day.Add(24 * time.Hour) {
-		//
-		//  周六没数据，跳过
-		//
-		if day.Weekday() == time.Saturday {
-			log.Warn("Skip Saturday %s.", day.Format("2006-01-02"))
-			continue
-		}
-		//
-		// 下载，解析，存储
-		//
-		if err = app.saveData(day, app.fetchDay(day)); err != nil {
+		var ticks []*core.TickData
+		if ticks, err = source.Ticks(opt.Symbol, day, day.Add(24*time.Hour)); err != nil {
+			log.Error("Load %s %s failed: %v.", opt.Symbol, day.Format("2006-01-02"), err)
 			break
 		}
+		if len(ticks) == 0 {
+			log.Warn("%s %s no ticks.", opt.Symbol, day.Format("2006-01-02"))
+			continue
+		}
 
+		app.sortAndOutput(day, ticks)
 		log.Info("%s %s finished.", opt.Symbol, day.Format("2006-01-02"))
 	}
 
@@ -215,56 +684,17 @@ func (app *DukaApp) Execute() error {
 	return err
 }
 
-// fetchDay 现在一天24小时的tick数据，24个goroutine并行下载，返回数据并不一定按时间顺序排序
-// 转换端需要按天对tick数据排序。
+// saveTesterSet save the expert inputs of tester ini into `folder`, which is shared by all the fxt files
 //
-func (app *DukaApp) fetchDay(day time.Time) <-chan *hReader {
-	ch := make(chan *hReader, 24)
-	opt := app.option
-
-	go func() {
-		defer close(ch)
-		var wg sync.WaitGroup
-
-		for hour := 0; hour < 24; hour++ {
-			wg.Add(1)
-			go func(h int) {
-				defer wg.Done()
-				dayH := day.Add(time.Duration(h) * time.Hour)
-				bi5File := bi5.New(dayH, opt.Symbol, opt.Folder)
-
-				var (
-					str  string
-					err  error
-					data []byte
-				)
-				if opt.Local {
-					str = "Load Bi5"
-					data, err = bi5File.Load()
-				} else {
-					str = "Download Bi5"
-					data, err = bi5File.Download()
-				}
-
-				if err != nil {
-					log.Error("%s, %s failed: %v.", str, dayH.Format("2006-01-02:15H"), err)
-					return
-				}
-				if len(data) > 0 {
-					select {
-					case ch <- &hReader{Data: data[:], DayH: dayH, Bi5: bi5File}:
-						//log.Trace("%s %s", str, dayH.Format("2006-01-02:15H"))
-						break
-					}
-				}
-			}(hour)
-		}
-
-		wg.Wait()
-		log.Trace("%s %s loaded.", opt.Symbol, day.Format("2006-01-02"))
-	}()
-
-	return ch
+func saveTesterSet(folder string, tester *fxt4.Tester) error {
+	fpath := filepath.Join(folder, tester.SetFile)
+	f, err := os.Create(fpath)
+	if err != nil {
+		log.Error("Create %s failed: %v.", fpath, err)
+		return err
+	}
+	defer f.Close()
+	return tester.WriteSet(f)
 }
 
 // sortAndOutput 按时间戳，从前到后排序当天tick数据
@@ -279,6 +709,11 @@ func (app *DukaApp) sortAndOutput(day time.Time, ticks []*core.TickData) error {
 		return ticks[i].Timestamp < ticks[j].Timestamp
 	})
 
+	// 加点差
+	if app.option.Markup != nil {
+		app.option.Markup.Apply(ticks)
+	}
+
 	// 输出到文件
 	for _, out := range app.outputs {
 		timestamp := uint32(day.Unix())
@@ -290,48 +725,3 @@ func (app *DukaApp) sortAndOutput(day time.Time, ticks []*core.TickData) error {
 	//log.Trace("%s sort and output day %v.", app.option.Format, tm)
 	return nil
 }
-
-// saveData
-func (app *DukaApp) saveData(day time.Time, chData <-chan *hReader) error {
-	var (
-		err error
-		opt = app.option
-	)
-
-	nDay := -1
-	dayTicks := make([]*core.TickData, 0, 2048)
-
-	for data := range chData {
-		// save bi5 by hour
-		bi5File := data.Bi5
-		var ticks []*core.TickData
-
-		// 解析 bi5 成 TickData 数据
-		if ticks, err = bi5File.Decode(data.Data[:]); err != nil {
-			log.Error("Decode bi5 %s: %s failed: %v.", opt.Symbol, data.DayH.Format("2006-01-02:15H"), err)
-			continue
-		}
-
-		// 保留 bi5 数据
-		if err := bi5File.Save(data.Data[:]); err != nil {
-			log.Error("Save Bi5 %s: %s failed: %v.", opt.Symbol, data.DayH.Format("2006-01-02:15H"), err)
-			continue
-		}
-
-		// 新的一天开始
-		if nDay != day.Day() {
-			app.sortAndOutput(day, dayTicks[:])
-			dayTicks = dayTicks[:0]
-			nDay = day.Day()
-		}
-
-		dayTicks = append(dayTicks, ticks...)
-	}
-
-	if len(dayTicks) > 0 {
-		app.sortAndOutput(day, dayTicks[:])
-	}
-
-	log.Trace("%s %s converted.", opt.Symbol, day.Format("2006-01-02"))
-	return err
-}
@@ -8,7 +8,7 @@ import (
 	"io"
 	"math"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/adyzng/go-duka/core"
 	"github.com/adyzng/go-duka/misc"
@@ -27,227 +27,429 @@ var (
 //		M - model number (0,1 or 2)
 //
 type FxtFile struct {
-	fpath          string
+	w              io.Writer
+	dst            core.Destination
+	closer         io.Closer
 	symbol         string
 	model          uint32
-	header         *FXTHeader
-	firstUniBar    *FxtTick
-	lastUniBar     *FxtTick
+	opt            *Option
+	spec           FXTHeader  // header before adjusted, copied for each file
+	header         *FXTHeader // header of current file
+	fname          string     // current file name under dst
+	partKey        string     // split key of current file
+	partSeq        int        // sequence of current file
+	size           int64      // bytes of header and ticks sent to current file
 	deltaTimestamp uint32
+	firstTimestamp uint32 // first bar after prolog
 	endTimestamp   uint32
 	timeframe      uint32
 	barCount       int32
+	prologCount    int32
 	tickCount      int64
-	chTicks        chan *FxtTick
+	lastTick       int64
+	modelErrors    uint32
+	err            error // the first failure, returned by later PackTicks and Finish
+	workerErr      error // failure of worker, read after chClose closed
+	chTicks        chan []byte
 	chClose        chan struct{}
 }
 
-// NewFxtFile create an new fxt file instance
-func NewFxtFile(timeframe, spread, model uint32, dest, symbol string) *FxtFile {
-	fn := fmt.Sprintf("%s%d_%d.fxt", symbol, timeframe, model)
+// FileName of fxt file, like EURUSD60_0.fxt
+//
+func FileName(symbol string, timeframe, model uint32) string {
+	return fmt.Sprintf("%s%d_%d.fxt", symbol, timeframe, model)
+}
+
+// PartName of split fxt file, like EURUSD60_0-2017-01.fxt, EURUSD60_0-2017-Q1.fxt, EURUSD60_0-2017.fxt,
+// or EURUSD60_0-001.fxt if split by size. The names are ordered by time.
+//
+func PartName(symbol string, timeframe, model uint32, key string) string {
+	return fmt.Sprintf("%s%d_%d-%s.fxt", symbol, timeframe, model, key)
+}
+
+// NewFxtFile create an new fxt file instance which save file `FileName` under `dest`,
+// or `PartName` files if split by option. Default option is used if `opt` is nil.
+func NewFxtFile(timeframe uint32, symbol, dest string, opt *Option) *FxtFile {
+	return newFxt(nil, core.NewFolder(dest), timeframe, symbol, opt)
+}
+
+// NewWriter create fxt convertor which write into `w`, `w` is not closed by Finish.
+// The bar count and dates in header are adjusted at Finish only if `w` is an io.WriteSeeker.
+// The split option is ignored.
+//
+func NewWriter(w io.Writer, timeframe uint32, symbol string, opt *Option) *FxtFile {
+	return newFxt(w, nil, timeframe, symbol, opt)
+}
+
+func newFxt(w io.Writer, dst core.Destination, timeframe uint32, symbol string, opt *Option) *FxtFile {
+	if opt == nil {
+		opt, _ = NewOption(ModelEveryTick, 0, "", "")
+	}
+
+	spec := opt.Spec
+	if spec == nil {
+		spec = NewSpec(symbol)
+	}
+	header := NewHeader(405, symbol, timeframe, opt.Spread, opt.Model)
+	spec.Apply(header)
+	if opt.SpreadMode == SpreadVariable {
+		// Ask = Bid + Volume in the patched tester
+		header.Spread = 0
+	}
+
 	fxt := &FxtFile{
-		header:         NewHeader(405, symbol, timeframe, spread, model),
-		fpath:          filepath.Join(dest, fn),
-		chTicks:        make(chan *FxtTick, 1024),
-		chClose:        make(chan struct{}, 1),
+		spec:           *header,
+		w:              w,
+		dst:            dst,
 		deltaTimestamp: timeframe * 60,
 		timeframe:      timeframe,
 		symbol:         symbol,
-		model:          model,
+		model:          opt.Model,
+		opt:            opt,
 	}
 
-	go fxt.worker()
+	if opt.Model == ModelControlPoints {
+		// no file is created
+		fxt.err = errControlPoints
+		return fxt
+	}
+	if !fxt.splitted() {
+		// the split files are started by the first tick of each
+		fxt.err = fxt.start(FileName(symbol, timeframe, opt.Model))
+	}
 	return fxt
 }
 
-func (f *FxtFile) worker() error {
-	defer func() {
-		close(f.chClose)
-		log.Info("M%d Saved Bar: %d, Ticks: %d.", f.timeframe, f.barCount, f.tickCount)
-	}()
-
-	fxt, err := os.OpenFile(f.fpath, os.O_CREATE|os.O_TRUNC, 666)
+// start the worker of file `fname`, which is created under dst if no writer given.
+// The header and counters are reset, the header is the first bytes sent to worker.
+func (f *FxtFile) start(fname string) error {
+	header := f.spec
+	bs, err := header.ToBytes()
 	if err != nil {
-		log.Fatal("Create file %s failed: %v.", f.fpath, err)
 		return err
 	}
 
-	defer fxt.Close()
-	bu := bytes.NewBuffer(make([]byte, 0, headerSize))
-
-	//
-	// convert FXT header
-	//
-	if err = binary.Write(bu, binary.LittleEndian, f.header); err != nil {
-		log.Error("Convert FXT header failed: %v.", err)
-		return err
-	}
-	// write FXT file
-	if _, err := fxt.Write(bu.Bytes()); err != nil {
-		log.Error("Write FXT header failed: %v.", err)
-		return err
-	}
+	f.header = &header
+	f.barCount, f.prologCount, f.tickCount, f.modelErrors = 0, 0, 0, 0
+	f.firstTimestamp, f.endTimestamp = 0, 0
+	f.fname = fname
+	f.size = int64(len(bs))
+	f.chTicks = make(chan []byte, 1024)
+	f.chClose = make(chan struct{}, 1)
+	f.chTicks <- bs
+	go f.worker()
+	return nil
+}
 
-	for tick := range f.chTicks {
+// splitted return true if the output is split into files
+func (f *FxtFile) splitted() bool {
+	return f.dst != nil && (f.opt.Split != "" || f.opt.SplitSize > 0)
+}
 
-		if tick.BarTimestamp > uint64(tick.TickTimestamp) {
-			log.Fatal("Tick(%v)", tick)
+// worker write the header and packed ticks into file, which is created under dst if no writer given
+func (f *FxtFile) worker() (err error) {
+	defer func() {
+		for range f.chTicks {
 		}
+		// counters are reset for the next part once chClose is closed
+		log.Info("M%d Saved Bar: %d, Ticks: %d.", f.timeframe, f.barCount, f.tickCount)
+		f.workerErr = err
+		close(f.chClose)
+	}()
 
-		bu.Reset()
-		//
-		//  write tick data
-		//
-		if err = binary.Write(bu, binary.LittleEndian, tick); err != nil {
-			log.Error("Pack tick failed: %v.", err)
-			break
-		}
-		if _, err = fxt.Write(bu.Bytes()); err != nil {
-			log.Error("Write fxt tick (%x) failed: %v.", bu.Bytes(), err)
-			break
+	if f.w == nil {
+		// closed by Finish after header adjusted
+		var wc io.WriteCloser
+		if wc, err = f.dst.Create(f.fname); err != nil {
+			log.Error("Create file %s failed: %v.", f.fname, err)
+			return err
 		}
+		f.w, f.closer = wc, wc
+	}
 
-		if f.firstUniBar == nil {
-			f.firstUniBar = tick
+	for bs := range f.chTicks {
+		if _, err = f.w.Write(bs); err != nil {
+			log.Error("Write fxt file %s failed: %v.", f.fname, err)
+			break
 		}
-		f.lastUniBar = tick
 	}
 	return err
 }
 
+// PackTicks pack the ticks of one bar and send them to the worker of current file.
+// The first failure is kept, and returned by the later calls and Finish.
+//
 func (f *FxtFile) PackTicks(barTimestemp uint32, ticks []*core.TickData) error {
+	if f.err != nil {
+		return f.err
+	}
 
+	ticks, errors := f.checkTicks(barTimestemp, ticks)
 	if len(ticks) == 0 {
+		f.modelErrors += errors
 		return nil
 	}
 
+	// prolog bar before tester start date is saved as one tick of the whole bar
+	prolog := barTimestemp < f.opt.From
+	if !prolog {
+		ticks = f.modelTicks(barTimestemp, ticks)
+	}
+
+	// running state of the bar at each tick
 	var (
-		op = ticks[0].Bid
-		hi = ticks[0].Bid
-		lo = ticks[0].Bid
-		vo = math.Max(ticks[0].VolumeBid, 1)
+		op    = ticks[0].Bid
+		hi    = ticks[0].Bid
+		lo    = ticks[0].Bid
+		vo    uint64
+		count int64
+		bu    = bytes.NewBuffer(make([]byte, 0, len(ticks)*tickSize))
 	)
 
-	for _, tick := range ticks {
+	for idx, tick := range ticks {
+		hi = math.Max(tick.Bid, hi)
+		lo = math.Min(tick.Bid, lo)
+		vo += uint64(math.Max(tick.VolumeBid*100, 1))
+		if prolog && idx < len(ticks)-1 {
+			continue
+		}
+
+		volume := vo
+		if f.opt.SpreadMode == SpreadVariable {
+			// spread in volume trick, the tester takes Bid + Volume as Ask
+			volume = uint64(math.Max(0, (tick.Ask-tick.Bid)/f.spec.PointSize+0.5))
+		}
+
+		launch := f.launchExpert(idx)
+		if prolog {
+			launch = 0
+		}
+
 		ft := &FxtTick{
 			BarTimestamp:  uint64(barTimestemp),
 			TickTimestamp: uint32(tick.Timestamp / 1000),
 			Open:          op,
-			High:          math.Max(tick.Bid, hi),
-			Low:           math.Min(tick.Bid, lo),
+			High:          hi,
+			Low:           lo,
 			Close:         tick.Bid,
-			Volume:        uint64(math.Max(tick.VolumeBid*100, 1)),
-			LaunchExpert:  3,
-			//RealSpread:    uint32(tick.Ask - tick.Bid/f.header.PointSize),
+			Volume:        volume,
+			LaunchExpert:  launch,
 		}
-		vo = vo + tick.VolumeBid
-		f.chTicks <- ft
-		f.tickCount++
+		if err := binary.Write(bu, binary.LittleEndian, ft); err != nil {
+			log.Error("Pack tick failed: %v.", err)
+			f.err = err
+			return err
+		}
+		count++
+	}
+
+	if err := f.split(barTimestemp, int64(bu.Len())); err != nil {
+		f.err = err
+		return err
 	}
+	f.chTicks <- bu.Bytes()
+	f.size += int64(bu.Len())
+	f.tickCount += count
+	f.modelErrors += errors
+
 	if f.endTimestamp != barTimestemp {
 		f.barCount++
 		f.endTimestamp = barTimestemp
+		if prolog {
+			f.prologCount++
+		} else if f.firstTimestamp == 0 {
+			f.firstTimestamp = barTimestemp
+		}
 	}
 	return nil
 }
 
-func (f *FxtFile) adjustHeader() error {
-	if f.barCount == 0 {
-		return nil
+// checkTicks drop the ticks out of the bar or earlier than the previous one,
+// the number of them is returned as model errors of header.
+func (f *FxtFile) checkTicks(barTimestamp uint32, ticks []*core.TickData) ([]*core.TickData, uint32) {
+	var (
+		start  = int64(barTimestamp) * 1000
+		end    = int64(core.NextBarTime(barTimestamp, f.timeframe)) * 1000
+		valid  = make([]*core.TickData, 0, len(ticks))
+		errors uint32
+	)
+	for _, tick := range ticks {
+		if tick.Timestamp < start || tick.Timestamp >= end || tick.Timestamp < f.lastTick {
+			log.Trace("Drop tick %v of bar %d.", tick, barTimestamp)
+			errors++
+			continue
+		}
+		valid = append(valid, tick)
+		f.lastTick = tick.Timestamp
 	}
+	return valid, errors
+}
 
-	fxt, err := os.OpenFile(f.fpath, os.O_RDWR, 666)
-	if err != nil {
-		log.Fatal("Open file %s failed: %v.", f.fpath, err)
-		return err
+// split start a new file for the bar of `size` bytes, if the split period of the bar changes,
+// or the file size would exceed the limit. Bars are never split, and the prolog bars are kept in the first file.
+func (f *FxtFile) split(barTimestamp uint32, size int64) error {
+	if !f.splitted() {
+		return nil
 	}
-	defer fxt.Close()
-
-	// first part
-	if _, err := fxt.Seek(216, os.SEEK_SET); err == nil {
-		d := struct {
-			BarCount          int32  // Total bar count
-			BarStartTimestamp uint32 // Modelling start date - date of the first tick.
-			BarEndTimestamp   uint32 // Modelling end date - date of the last tick.
-		}{
-			f.barCount,
-			uint32(f.firstUniBar.BarTimestamp),
-			uint32(f.lastUniBar.BarTimestamp),
-		}
 
-		bu := new(bytes.Buffer)
-		if err = binary.Write(bu, binary.LittleEndian, &d); err == nil {
-			_, err = fxt.Write(bu.Bytes())
-		}
-		if err != nil {
-			log.Error("Adjust FXT header 1 failed: %v.", err)
-			return err
-		}
-	} else {
-		log.Error("File seek 1 failed: %v.", err)
-		return err
+	// the key of prolog bars is the key of tester start date
+	key := f.opt.partKey(barTimestamp)
+	if barTimestamp < f.opt.From {
+		key = f.opt.partKey(f.opt.From)
 	}
 
-	// end part
-	if _, err := fxt.Seek(472, os.SEEK_SET); err == nil {
-		d := struct {
-			BarStartTimestamp uint32 // Tester start date - date of the first tick.
-			BarEndTimestamp   uint32 // Tester end date - date of the last tick.
-		}{
-			uint32(f.firstUniBar.BarTimestamp),
-			uint32(f.lastUniBar.BarTimestamp),
+	if f.chTicks != nil {
+		if f.firstTimestamp == 0 {
+			// keep the prolog with the first bar after it
+			f.partKey = key
+			return nil
 		}
-		bu := new(bytes.Buffer)
-		if err = binary.Write(bu, binary.LittleEndian, &d); err == nil {
-			_, err = fxt.Write(bu.Bytes())
+		if key == f.partKey && (f.opt.SplitSize == 0 || f.size+size <= f.opt.SplitSize) {
+			return nil
 		}
-		if err != nil {
-			log.Error("Adjust FXT header 2 failed: %v.", err)
+		if err := f.finishPart(false); err != nil {
 			return err
 		}
-	} else {
-		log.Error("File seek 2 failed: %v.", err)
-		return err
 	}
 
+	f.partSeq++
+	f.partKey = key
+	name := key
+	if f.opt.SplitSize > 0 {
+		name = fmt.Sprintf("%03d", f.partSeq)
+	}
+	return f.start(PartName(f.symbol, f.timeframe, f.model, name))
+}
+
+// adjustHeader fill the bar ranges of header, and rewrite it at the beginning of file
+//
+//	ModeledBars, FirstBarTime, LastBarTime : bars after prolog
+//	FirstBar, LastBar                      : 1-based index of the first bar after prolog, and the last bar
+//	StartPeriodM1 ... StartPeriodH4        : all start at FirstBar, as the bars are modeled by ticks
+//	TesterSettingFrom, TesterSettingTo     : tester dates, the dates of the first and last bars by default,
+//	                                         or if the file is not the first or last one of split files
+//	ModelErrors                            : ticks dropped by checkTicks
+//
+func (f *FxtFile) adjustHeader(last bool) error {
+	if f.barCount == 0 {
+		return nil
+	}
+
+	fxt, ok := f.w.(io.WriteSeeker)
+	if !ok {
+		log.Warn("FXT header not adjusted, output is not seekable.")
+		return nil
+	}
+
+	h := f.header
+	h.ModeledBars = uint32(f.barCount - f.prologCount)
+	h.FirstBarTime = f.firstTimestamp
+	h.LastBarTime = f.endTimestamp
+	h.FirstBar = uint32(f.prologCount) + 1
+	h.LastBar = uint32(f.barCount)
+	h.StartPeriodM1 = h.FirstBar
+	h.StartPeriodM5 = h.FirstBar
+	h.StartPeriodM15 = h.FirstBar
+	h.StartPeriodM30 = h.FirstBar
+	h.StartPeriodH1 = h.FirstBar
+	h.StartPeriodH4 = h.FirstBar
+	h.TesterSettingFrom = f.opt.From
+	if h.TesterSettingFrom == 0 || f.partSeq > 1 {
+		h.TesterSettingFrom = core.BarTime(f.firstTimestamp, 1440)
+	}
+	h.TesterSettingTo = f.opt.To
+	if h.TesterSettingTo == 0 || !last {
+		h.TesterSettingTo = core.BarTime(f.endTimestamp, 1440)
+	}
+	h.ModelErrors = f.modelErrors
+	if h.ModeledBars == 0 {
+		log.Warn("No bar after tester start date %d.", f.opt.From)
+	}
+
+	bu := bytes.NewBuffer(make([]byte, 0, headerSize))
+	if err := binary.Write(bu, binary.LittleEndian, h); err != nil {
+		log.Error("Convert FXT header failed: %v.", err)
+		return err
+	}
+	if _, err := fxt.Seek(0, io.SeekStart); err != nil {
+		log.Error("File seek failed: %v.", err)
+		return err
+	}
+	if _, err := fxt.Write(bu.Bytes()); err != nil {
+		log.Error("Adjust FXT header failed: %v.", err)
+		return err
+	}
 	return nil
 }
 
+// Finish complete the current file, the error of previous PackTicks is returned if any
+//
 func (f *FxtFile) Finish() error {
+	if f.chTicks == nil {
+		// no split file started, or finished on error
+		return f.err
+	}
+	if err := f.finishPart(true); f.err == nil {
+		f.err = err
+	}
+	return f.err
+}
+
+// finishPart wait the worker of current file, then adjust header and close the file.
+// The worker of the file is gone once returned, even on error.
+func (f *FxtFile) finishPart(last bool) error {
 	close(f.chTicks)
 	<-f.chClose
-	return f.adjustHeader()
+	f.chTicks = nil
+
+	err := f.workerErr
+	if err == nil {
+		err = f.adjustHeader(last)
+	}
+	if f.closer != nil {
+		if e := f.closer.Close(); err == nil {
+			err = e
+		}
+		f.w, f.closer = nil, nil
+	}
+	if err == nil && f.opt.Tester != nil && f.dst != nil && f.barCount > 0 {
+		err = f.saveTester()
+	}
+	return err
 }
 
-// DumpFile dump fxt file into txt format
-//
-func DumpFile(fname string, header bool, w io.Writer) {
-	fh, err := os.OpenFile(fname, os.O_RDONLY, 666)
+// saveTester save the tester ini of current file, like EURUSD60_0.ini
+func (f *FxtFile) saveTester() error {
+	report := strings.TrimSuffix(f.fname, ".fxt")
+	wc, err := f.dst.Create(report + ".ini")
 	if err != nil {
-		log.Error("Open fxt file failed: %v.", err)
-		return
+		log.Error("Create tester ini of %s failed: %v.", f.fname, err)
+		return err
 	}
-	defer fh.Close()
-
-	bs := make([]byte, headerSize)
-	n, err := fh.Read(bs[:])
-	if err != nil || n != headerSize {
-		log.Error("Read fxt header failed: %v.", err)
-		return
+	if err = f.opt.Tester.WriteINI(wc, f.header, report); err != nil {
+		log.Error("Write tester ini of %s failed: %v.", f.fname, err)
 	}
+	if e := wc.Close(); err == nil {
+		err = e
+	}
+	return err
+}
 
-	var h FXTHeader
-	err = binary.Read(bytes.NewBuffer(bs[:]), binary.LittleEndian, &h)
+// DumpFile dump fxt file into txt format
+//
+func DumpFile(fname string, header bool, w io.Writer) {
+	r, err := NewReader(fname)
 	if err != nil {
-		log.Error("Decode fxt header failed: %v.", err)
+		log.Error("Open fxt file failed: %v.", err)
 		return
 	}
+	defer r.Close()
 
 	if w == nil {
 		w = os.Stdout
 	}
 	bw := bufio.NewWriter(w)
-	bw.WriteString(fmt.Sprintf("Header: %+v\n", h))
+	bw.WriteString(fmt.Sprintf("Header: %+v\n", *r.Header()))
 	defer bw.Flush()
 
 	if header {
@@ -255,25 +457,15 @@ func DumpFile(fname string, header bool, w io.Writer) {
 		return
 	}
 
-	tickBs := make([]byte, tickSize)
 	for {
-		n, err = fh.Read(tickBs[:tickSize])
+		tick, err := r.Read()
 		if err == io.EOF {
 			break
 		}
-
-		if n != tickSize || err != nil {
-			log.Error("Read tick data failed: %v.", err)
-			break
-		}
-
-		var tick FxtTick
-		err = binary.Read(bytes.NewBuffer(tickBs[:]), binary.LittleEndian, &tick)
 		if err != nil {
-			log.Error("Decode tick data failed: %v.", err)
+			log.Error("Read tick data failed: %v.", err)
 			break
 		}
-
-		bw.WriteString(fmt.Sprintf("%s\n", &tick))
+		bw.WriteString(fmt.Sprintf("%s\n", tick))
 	}
 }
@@ -3,19 +3,46 @@ package fxt4
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/adyzng/go-duka/core"
 )
 
+// testDay is the day of the tick fixtures
+var testDay = time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// tempDir create a temp folder for the output files, it's removed by the returned func
+func tempDir(t *testing.T) (string, func()) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	return dest, func() { os.RemoveAll(dest) }
+}
+
+// barTicks create the ticks of bids in the bar, one per second from the open, ask is 1 pip above bid
+func barTicks(bar time.Time, bids ...float64) []*core.TickData {
+	ms := bar.Unix() * 1000
+	ticks := make([]*core.TickData, 0, len(bids))
+	for idx, bid := range bids {
+		ticks = append(ticks, &core.TickData{Timestamp: ms + int64(idx+1)*1000, Bid: bid, Ask: bid + 0.0001, VolumeBid: 1})
+	}
+	return ticks
+}
+
 func TestFxtFile(t *testing.T) {
 	fn := 1e-5 + 0.123
 	fmt.Println(fn)
 
-	fxt := NewFxtFile(1, 20, 0, "D:\\Data", "EURUSD")
+	fxt := NewFxtFile(1, "EURUSD", "D:\\Data", &Option{Spread: 20})
 	fxt.PackTicks(0, []*core.TickData{&core.TickData{}})
 }
 
@@ -67,3 +94,658 @@ func TestHeader(t *testing.T) {
 		//break
 	}
 }
+
+// readTicks decode the ticks after header
+func readTicks(t *testing.T, bs []byte) []*FxtTick {
+	if len(bs) < headerSize || (len(bs)-headerSize)%tickSize != 0 {
+		t.Fatalf("Unexpected fxt size %d.\n", len(bs))
+	}
+
+	ticks := make([]*FxtTick, 0)
+	r := bytes.NewReader(bs[headerSize:])
+	for r.Len() > 0 {
+		tick := &FxtTick{}
+		if err := binary.Read(r, binary.LittleEndian, tick); err != nil {
+			t.Fatalf("Decode tick failed: %v.\n", err)
+		}
+		ticks = append(ticks, tick)
+	}
+	return ticks
+}
+
+// readFile read the header and ticks of fxt file
+func readFile(t *testing.T, fpath string) (*FXTHeader, []*FxtTick) {
+	bs, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatalf("Read fxt file failed: %v.\n", err)
+	}
+	h, err := ReadHeader(bytes.NewReader(bs))
+	if err != nil {
+		t.Fatalf("Read fxt header of %s failed: %v.\n", fpath, err)
+	}
+	return h, readTicks(t, bs)
+}
+
+func TestFxtModels(t *testing.T) {
+	if _, err := NewOption(3, 20, "", ""); err == nil {
+		t.Errorf("Expect error of invalid model.\n")
+	}
+
+	ms := testDay.Unix() * 1000
+
+	// M5 bar with ticks in 2 M1 bars
+	ticks := []*core.TickData{
+		{Timestamp: ms + 1000, Bid: 1.05100, Ask: 1.05110, VolumeBid: 1},
+		{Timestamp: ms + 2000, Bid: 1.05050, Ask: 1.05060, VolumeBid: 1},
+		{Timestamp: ms + 3000, Bid: 1.05200, Ask: 1.05210, VolumeBid: 1},
+		{Timestamp: ms + 4000, Bid: 1.05150, Ask: 1.05160, VolumeBid: 1},
+		{Timestamp: ms + 61000, Bid: 1.05150, Ask: 1.05160, VolumeBid: 1},
+		{Timestamp: ms + 62000, Bid: 1.05000, Ask: 1.05010, VolumeBid: 1},
+	}
+
+	for model, expect := range map[uint32][]float64{
+		ModelEveryTick:  {1.05100, 1.05050, 1.05200, 1.05150, 1.05150, 1.05000},
+		ModelOpenPrices: {1.05100, 1.05200, 1.05000},
+	} {
+		var buf bytes.Buffer
+		fxt := NewWriter(&buf, 5, "EURUSD", &Option{Model: model, Spread: 20})
+		fxt.PackTicks(uint32(testDay.Unix()), ticks)
+		fxt.Finish()
+
+		fts := readTicks(t, buf.Bytes())
+		if len(fts) != len(expect) {
+			t.Fatalf("Model %d expect %d ticks, got %d.\n", model, len(expect), len(fts))
+		}
+		for idx, tick := range fts {
+			launch := uint32(3)
+			if model == ModelOpenPrices && idx > 0 {
+				launch = 0
+			}
+			if tick.Close != expect[idx] || tick.LaunchExpert != launch || tick.BarTimestamp != uint64(testDay.Unix()) {
+				t.Errorf("Model %d tick %d: unexpected %+v.\n", model, idx, tick)
+			}
+			if tick.TickTimestamp < uint32(tick.BarTimestamp) || (idx > 0 && tick.TickTimestamp < fts[idx-1].TickTimestamp) {
+				t.Errorf("Model %d tick %d: unexpected time %v.\n", model, idx, tick)
+			}
+		}
+	}
+}
+
+func TestFxtControlPoints(t *testing.T) {
+	if _, err := NewOption(ModelControlPoints, 20, "", ""); err == nil {
+		t.Errorf("Expect error of control points model.\n")
+	}
+
+	var buf bytes.Buffer
+	fxt := NewWriter(&buf, 5, "EURUSD", &Option{Model: ModelControlPoints, Spread: 20})
+	err := fxt.PackTicks(0, []*core.TickData{{Timestamp: 1000, Bid: 1.05100, Ask: 1.05110, VolumeBid: 1}})
+	if err == nil || fxt.Finish() == nil || buf.Len() != 0 {
+		t.Errorf("Expect error of control points model, got %d bytes.\n", buf.Len())
+	}
+}
+
+func TestFxtRunningBar(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	ms := testDay.Unix() * 1000
+
+	fxt := NewFxtFile(1, "EURUSD", dest, nil)
+	fxt.PackTicks(uint32(testDay.Unix()), []*core.TickData{
+		{Timestamp: ms + 1000, Bid: 1.05100, VolumeBid: 0.5},
+		{Timestamp: ms + 2000, Bid: 1.05200, VolumeBid: 0.25},
+		{Timestamp: ms + 3000, Bid: 1.05000, VolumeBid: 0.001},
+		{Timestamp: ms + 4000, Bid: 1.05150, VolumeBid: 1},
+	})
+	fxt.PackTicks(uint32(testDay.Unix())+60, []*core.TickData{
+		{Timestamp: ms + 61000, Bid: 1.05300, VolumeBid: 2},
+		{Timestamp: ms + 62000, Bid: 1.05250, VolumeBid: 1},
+	})
+	if err := fxt.Finish(); err != nil {
+		t.Fatalf("Finish fxt failed: %v.\n", err)
+	}
+
+	// reference ticks: open, running high, running low, close, cumulative volume
+	expect := []FxtTick{
+		{Open: 1.05100, High: 1.05100, Low: 1.05100, Close: 1.05100, Volume: 50},
+		{Open: 1.05100, High: 1.05200, Low: 1.05100, Close: 1.05200, Volume: 75},
+		{Open: 1.05100, High: 1.05200, Low: 1.05000, Close: 1.05000, Volume: 76},
+		{Open: 1.05100, High: 1.05200, Low: 1.05000, Close: 1.05150, Volume: 176},
+		{Open: 1.05300, High: 1.05300, Low: 1.05300, Close: 1.05300, Volume: 200},
+		{Open: 1.05300, High: 1.05300, Low: 1.05250, Close: 1.05250, Volume: 300},
+	}
+
+	h, ticks := readFile(t, filepath.Join(dest, FileName("EURUSD", 1, 0)))
+	if len(ticks) != len(expect) {
+		t.Fatalf("Expect %d ticks, got %d.\n", len(expect), len(ticks))
+	}
+	for idx, tick := range ticks {
+		e := expect[idx]
+		if tick.Open != e.Open || tick.High != e.High || tick.Low != e.Low || tick.Close != e.Close || tick.Volume != e.Volume {
+			t.Errorf("Tick %d: expect %v, got %v.\n", idx, &e, tick)
+		}
+	}
+
+	start := uint32(testDay.Unix())
+	if h.ModeledBars != 2 || h.FirstBarTime != start || h.LastBarTime != start+60 || h.FirstBar != 1 || h.LastBar != 2 ||
+		h.TesterSettingFrom != start || h.TesterSettingTo != start || h.ModelErrors != 0 {
+		t.Errorf("Unexpected header %+v.\n", h)
+	}
+}
+
+// TestFxtReference replay the ticks of the fxt files generated by MT4 tester under testdata/mt4,
+// like EURUSD15_0.fxt of a short tester range, and compare the output with the header fields
+// of bar ranges and every tick. The prolog bars are replayed as open, high, low, close ticks.
+func TestFxtReference(t *testing.T) {
+	names, _ := filepath.Glob(filepath.Join("testdata", "mt4", "*_0.fxt"))
+	if len(names) == 0 {
+		t.Skip("No fxt file of MT4 tester under testdata/mt4.")
+	}
+
+	dest, clean := tempDir(t)
+	defer clean()
+
+	for _, name := range names {
+		ref, refTicks := readFile(t, name)
+		folder := filepath.Join(dest, filepath.Base(name))
+		os.MkdirAll(folder, 0777)
+
+		symbol := ref.SymbolName()
+		opt := &Option{Spread: ref.Spread, From: ref.FirstBarTime, To: ref.TesterSettingTo}
+		fxt := NewFxtFile(ref.Period, symbol, folder, opt)
+		for begin := 0; begin < len(refTicks); {
+			end := begin + 1
+			for end < len(refTicks) && refTicks[end].BarTimestamp == refTicks[begin].BarTimestamp {
+				end++
+			}
+			fxt.PackTicks(uint32(refTicks[begin].BarTimestamp), replayTicks(symbol, ref.PointSize*float64(ref.Spread), refTicks[begin:end]))
+			begin = end
+		}
+		if err := fxt.Finish(); err != nil {
+			t.Fatalf("Finish fxt of %s failed: %v.\n", name, err)
+		}
+
+		h, ticks := readFile(t, filepath.Join(folder, FileName(symbol, ref.Period, 0)))
+		for _, field := range []struct {
+			name     string
+			ref, got uint32
+		}{
+			{"ModeledBars", ref.ModeledBars, h.ModeledBars},
+			{"FirstBarTime", ref.FirstBarTime, h.FirstBarTime},
+			{"LastBarTime", ref.LastBarTime, h.LastBarTime},
+			{"FirstBar", ref.FirstBar, h.FirstBar},
+			{"LastBar", ref.LastBar, h.LastBar},
+			{"TesterSettingFrom", ref.TesterSettingFrom, h.TesterSettingFrom},
+			{"TesterSettingTo", ref.TesterSettingTo, h.TesterSettingTo},
+			{"ModelErrors", ref.ModelErrors, h.ModelErrors},
+		} {
+			if field.ref != field.got {
+				t.Errorf("%s: expect header %s %d, got %d.\n", name, field.name, field.ref, field.got)
+			}
+		}
+
+		if len(ticks) != len(refTicks) {
+			t.Fatalf("%s: expect %d ticks, got %d.\n", name, len(refTicks), len(ticks))
+		}
+		for idx, tick := range ticks {
+			if *tick != *refTicks[idx] {
+				t.Errorf("%s: tick %d expect %v, got %v.\n", name, idx, refTicks[idx], tick)
+			}
+		}
+	}
+}
+
+// replayTicks restore the source ticks of one bar in fxt, the volume of each tick is the increment of the bar volume
+func replayTicks(symbol string, spread float64, fts []*FxtTick) []*core.TickData {
+	var (
+		ticks  = make([]*core.TickData, 0, len(fts))
+		volume uint64
+	)
+	add := func(tm uint32, bid float64, vol uint64) {
+		ticks = append(ticks, &core.TickData{
+			Symbol:    symbol,
+			Timestamp: int64(tm) * 1000,
+			Bid:       bid,
+			Ask:       bid + spread,
+			VolumeBid: float64(vol) / 100,
+		})
+	}
+
+	if ft := fts[0]; len(fts) == 1 && ft.LaunchExpert == 0 {
+		// prolog bar in one tick, at least 1 volume of each tick
+		bar := uint32(ft.BarTimestamp)
+		add(bar, ft.Open, 1)
+		add(bar, ft.High, 1)
+		add(bar, ft.Low, 1)
+		add(ft.TickTimestamp, ft.Close, ft.Volume-3)
+		return ticks
+	}
+	for _, ft := range fts {
+		add(ft.TickTimestamp, ft.Close, ft.Volume-volume)
+		volume = ft.Volume
+	}
+	return ticks
+}
+
+func TestFxtVariableSpread(t *testing.T) {
+	ms := testDay.Unix() * 1000
+
+	opt, err := NewOption(ModelEveryTick, 20, SpreadVariable, "")
+	if err != nil {
+		t.Fatalf("Create option failed: %v.\n", err)
+	}
+
+	var buf bytes.Buffer
+	fxt := NewWriter(&buf, 1, "EURUSD", opt)
+	fxt.PackTicks(uint32(testDay.Unix()), []*core.TickData{
+		{Timestamp: ms + 1000, Bid: 1.05100, Ask: 1.05112, VolumeBid: 1},
+		{Timestamp: ms + 2000, Bid: 1.05200, Ask: 1.05235, VolumeBid: 1},
+	})
+	fxt.Finish()
+
+	var h FXTHeader
+	binary.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, &h)
+	if h.Spread != 0 {
+		t.Errorf("Expect zero spread in header, got %d.\n", h.Spread)
+	}
+
+	ticks := readTicks(t, buf.Bytes())
+	if len(ticks) != 2 || ticks[0].Volume != 12 || ticks[1].Volume != 35 {
+		t.Errorf("Unexpected spread in volume %v.\n", ticks)
+	}
+}
+
+func TestFxtSpec(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	fjson := filepath.Join(dest, "spec.json")
+	ioutil.WriteFile(fjson, []byte(`{"usdjpy": {"server": "Broker-Live", "leverage": 500, "swap_long": -2.5, "commission": 7}}`), 0666)
+	fini := filepath.Join(dest, "spec.ini")
+	ioutil.WriteFile(fini, []byte("server = Broker-Live\n[EURUSD]\nleverage = 30\n[UsdJpy]\nleverage = 500\nswap_short = 1.25\n"), 0666)
+	fyaml := filepath.Join(dest, "spec.yaml")
+	ioutil.WriteFile(fyaml, []byte("EURUSD:\n  leverage: 30\nUsdJpy:\n  server: Broker-Live\n  leverage: 500\n  swap_long: -2.5\n"), 0666)
+
+	// symbol keys of any case
+	for _, fpath := range []string{fjson, fini, fyaml} {
+		spec, err := LoadSpec(fpath, "USDJPY")
+		if err != nil {
+			t.Fatalf("Load spec %s failed: %v.\n", fpath, err)
+		}
+		if spec.Leverage != 500 || spec.Server != "Broker-Live" || spec.Digits != 3 || spec.ContractSize != 100000 {
+			t.Errorf("Unexpected spec of %s: %+v.\n", fpath, spec)
+		}
+	}
+
+	// point follows digits if it's not given
+	fdigits := filepath.Join(dest, "digits.yml")
+	ioutil.WriteFile(fdigits, []byte("XAUUSD:\n  digits: 2\nXAGUSD:\n  point: 0.01\n  digits: 3\n"), 0666)
+	for symbol, expect := range map[string]error{"XAUUSD": nil, "XAGUSD": fmt.Errorf("point 0.01 doesn't match digits 3")} {
+		spec, err := LoadSpec(fdigits, symbol)
+		if err != nil {
+			t.Fatalf("Load spec %s failed: %v.\n", fdigits, err)
+		}
+		if err = spec.Validate(); fmt.Sprint(err) != fmt.Sprint(expect) {
+			t.Errorf("Validate %s: expect %v, got %v.\n", symbol, expect, err)
+		}
+	}
+	spec := NewSpec("EURUSD")
+	if spec.Set("digits=2"); spec.Point != 0.01 || spec.Validate() != nil {
+		t.Errorf("Expect point 0.01 of digits 2, got %v.\n", spec.Point)
+	}
+	if spec.Set("point=0.001"); spec.Validate() == nil {
+		t.Errorf("Expect error of point not matching digits.\n")
+	}
+
+	spec = NewSpec("USDJPY")
+	if err := spec.Set("swap_long=-2.5"); err != nil || spec.SwapLong != -2.5 {
+		t.Errorf("Set swap_long failed: %v.\n", err)
+	}
+	if err := spec.Set("leverage=abc"); err == nil {
+		t.Errorf("Expect error of invalid value.\n")
+	}
+	if err := spec.Set("unknown=1"); err == nil {
+		t.Errorf("Expect error of unknown key.\n")
+	}
+	if spec.Set("profit_mode=5"); spec.Validate() == nil {
+		t.Errorf("Expect error of invalid profit mode.\n")
+	}
+	spec.Set("profit_mode=0")
+
+	var buf bytes.Buffer
+	fxt := NewWriter(&buf, 1, "USDJPY", &Option{Spread: 20, Spec: spec})
+	fxt.Finish()
+
+	var h FXTHeader
+	binary.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, &h)
+	if h.Digits != 3 || h.PointSize != 0.001 || h.SwapLongValue != -2.5 || h.Spread != 20 || h.MinLotsize != 1 {
+		t.Errorf("Unexpected header %+v.\n", h)
+	}
+}
+
+func TestFxtSymbolsRaw(t *testing.T) {
+	if size := binary.Size(&Symbol{}); size != symbolSize {
+		t.Fatalf("Unexpected symbol size %d.\n", size)
+	}
+
+	dest, clean := tempDir(t)
+	defer clean()
+
+	var buf bytes.Buffer
+	for _, name := range []string{"EURUSD.pro", "USDJPY"} {
+		sym := &Symbol{Digits: 3, PointSize: 0.001, ContractSize: 100000, Spread: 12, StopsLevel: 5, SwapLong: -4.5, MarginCalcMode: 1}
+		copy(sym.Name[:], name)
+		copy(sym.BaseCurrency[:], name[:3])
+		copy(sym.MarginCurrency[:], name[:3])
+		if name == "EURUSD.pro" {
+			sym.Digits, sym.PointSize, sym.ProfitCalcMode = 5, 0.00001, 1
+		}
+		binary.Write(&buf, binary.LittleEndian, sym)
+	}
+	fpath := filepath.Join(dest, "symbols.raw")
+	ioutil.WriteFile(fpath, buf.Bytes(), 0666)
+
+	symbols, err := ReadSymbols(fpath)
+	if err != nil || len(symbols) != 2 {
+		t.Fatalf("Read symbols.raw failed: %v.\n", err)
+	}
+
+	spec := NewSpec("EURUSD")
+	if err = spec.Load(fpath, "eurusd"); err != nil {
+		t.Fatalf("Load symbols.raw failed: %v.\n", err)
+	}
+	if spec.Digits != 5 || spec.Point != 0.00001 || spec.Spread != 12 || spec.StopsLevel != 5 ||
+		spec.SwapLong != -4.5 || spec.MarginMode != 1 || spec.ProfitMode != 1 || spec.BaseCurrency != "EUR" {
+		t.Errorf("Unexpected spec %+v.\n", spec)
+	}
+	if err = spec.Validate(); err != nil {
+		t.Errorf("Validate spec failed: %v.\n", err)
+	}
+
+	if _, err = FindSymbol(fpath, "GBPUSD"); err == nil {
+		t.Errorf("Expect error of missing symbol.\n")
+	}
+	ioutil.WriteFile(fpath, buf.Bytes()[:symbolSize+10], 0666)
+	if _, err = ReadSymbols(fpath); err == nil {
+		t.Errorf("Expect error of truncated file.\n")
+	}
+}
+
+// TestFxtSymbolsReference read testdata/mt4/symbols.raw copied from the history folder of MT4 terminal,
+// and compare the specification of each symbol in testdata/mt4/symbols.json, which is written down
+// from the symbol properties of the same terminal, like:
+//
+//	{"EURUSD": {"digits": 5, "spread": 12, "stops_level": 5, "swap_long": -4.5, ...}}
+//
+func TestFxtSymbolsReference(t *testing.T) {
+	fraw, fjson := filepath.Join("testdata", "mt4", "symbols.raw"), filepath.Join("testdata", "mt4", "symbols.json")
+	bs, err := ioutil.ReadFile(fjson)
+	if err != nil {
+		t.Skip("No symbols.raw of MT4 terminal under testdata/mt4.")
+	}
+
+	symbols := make(map[string]interface{})
+	if err = json.Unmarshal(bs, &symbols); err != nil {
+		t.Fatalf("Decode %s failed: %v.\n", fjson, err)
+	}
+	for symbol := range symbols {
+		expect, got := NewSpec(symbol), NewSpec(symbol)
+		if err = expect.Load(fjson, symbol); err != nil {
+			t.Fatalf("Load %s failed: %v.\n", fjson, err)
+		}
+		if err = got.Load(fraw, symbol); err != nil {
+			t.Fatalf("Load %s failed: %v.\n", fraw, err)
+		}
+		if *got != *expect {
+			t.Errorf("%s: expect spec\n%+v, got\n%+v.\n", symbol, expect, got)
+		}
+	}
+}
+
+func TestFxtVerify(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	ms := testDay.Unix() * 1000
+
+	fxt := NewFxtFile(5, "EURUSD", dest, &Option{Spread: 20})
+	fxt.PackTicks(uint32(testDay.Unix()), []*core.TickData{
+		{Timestamp: ms + 1000, Bid: 1.05100, Ask: 1.05110, VolumeBid: 1},
+		{Timestamp: ms + 61000, Bid: 1.05150, Ask: 1.05160, VolumeBid: 1},
+	})
+	fxt.PackTicks(uint32(testDay.Unix())+300, []*core.TickData{
+		{Timestamp: ms + 301000, Bid: 1.05000, Ask: 1.05010, VolumeBid: 1},
+		{Timestamp: ms + 302000, Bid: 1.05050, Ask: 1.05060, VolumeBid: 1},
+	})
+	if err := fxt.Finish(); err != nil {
+		t.Fatalf("Finish fxt failed: %v.\n", err)
+	}
+
+	fpath := filepath.Join(dest, FileName("EURUSD", 5, 0))
+	r, err := NewReader(fpath)
+	if err != nil {
+		t.Fatalf("Open fxt failed: %v.\n", err)
+	}
+	var ticks int
+	for {
+		if _, err = r.Read(); err != nil {
+			break
+		}
+		ticks++
+	}
+	r.Close()
+	if err != io.EOF || ticks != 4 || r.Header().ModeledBars != 2 || r.Header().SymbolName() != "EURUSD" {
+		t.Errorf("Unexpected reader result: %v, %d ticks, header %+v.\n", err, ticks, *r.Header())
+	}
+
+	report, err := Verify(fpath)
+	if err != nil {
+		t.Fatalf("Verify fxt failed: %v.\n", err)
+	}
+	// minutes 0, 1 and 5 have ticks, 2 - 4 are missing
+	if !report.OK() || report.Bars != 2 || report.Ticks != 4 || report.Minutes != 3 || report.Missing != 3 ||
+		math.Abs(report.Quality-49.95) > 1e-9 {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+
+	// break the header and the last tick
+	bs, _ := ioutil.ReadFile(fpath)
+	binary.LittleEndian.PutUint32(bs[216:], 5)
+	last := headerSize + 3*tickSize
+	binary.LittleEndian.PutUint64(bs[last:], uint64(testDay.Unix())+360)
+	binary.LittleEndian.PutUint64(bs[last+32:], math.Float64bits(2.1))
+	ioutil.WriteFile(fpath, bs, 0666)
+
+	if report, err = Verify(fpath); err != nil {
+		t.Fatalf("Verify fxt failed: %v.\n", err)
+	}
+	// bar count, last bar time and index, alignment, tick before bar, range and spike
+	if report.OK() || report.Errors != 7 {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+}
+
+func TestFxtProlog(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	start := testDay.Add(24 * time.Hour)
+	fxt := NewFxtFile(60, "EURUSD", dest, &Option{Spread: 20, From: uint32(start.Unix()), To: uint32(start.Unix())})
+
+	// 2 prolog bars and 2 tester bars, the last tick of the first tester bar is out of bar
+	for _, bar := range []time.Time{testDay, testDay.Add(time.Hour), start, start.Add(time.Hour)} {
+		ticks := barTicks(bar, 1.05100, 1.05200, 1.05000)
+		if bar == start {
+			ticks = append(ticks, &core.TickData{Timestamp: bar.Unix()*1000 + 3600000, Bid: 1.05, Ask: 1.05})
+		}
+		fxt.PackTicks(uint32(bar.Unix()), ticks)
+	}
+	if err := fxt.Finish(); err != nil {
+		t.Fatalf("Finish fxt failed: %v.\n", err)
+	}
+
+	fpath := filepath.Join(dest, FileName("EURUSD", 60, 0))
+	bs, _ := ioutil.ReadFile(fpath)
+	var h FXTHeader
+	binary.Read(bytes.NewReader(bs), binary.LittleEndian, &h)
+	if h.ModeledBars != 2 || h.FirstBarTime != uint32(start.Unix()) || h.LastBarTime != uint32(start.Unix())+3600 ||
+		h.FirstBar != 3 || h.LastBar != 4 || h.StartPeriodM1 != 3 || h.StartPeriodH4 != 3 ||
+		h.TesterSettingFrom != uint32(start.Unix()) || h.TesterSettingTo != uint32(start.Unix()) || h.ModelErrors != 1 {
+		t.Errorf("Unexpected header %+v.\n", h)
+	}
+
+	// one tick of each prolog bar with the whole bar
+	ticks := readTicks(t, bs)
+	if len(ticks) != 8 {
+		t.Fatalf("Expect 8 ticks, got %d.\n", len(ticks))
+	}
+	if tick := ticks[0]; tick.Open != 1.051 || tick.High != 1.052 || tick.Low != 1.05 || tick.Close != 1.05 ||
+		tick.Volume != 300 || tick.LaunchExpert != 0 || tick.TickTimestamp != uint32(testDay.Unix())+3 {
+		t.Errorf("Unexpected prolog tick %v.\n", tick)
+	}
+	if tick := ticks[2]; tick.Close != 1.051 || tick.LaunchExpert != 3 {
+		t.Errorf("Unexpected tester tick %v.\n", tick)
+	}
+
+	report, err := Verify(fpath)
+	if err != nil {
+		t.Fatalf("Verify fxt failed: %v.\n", err)
+	}
+	if report.Errors != 1 || report.Bars != 4 || report.Minutes != 2 {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+}
+
+func TestFxtSplit(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	if opt, err := NewOption(0, 20, "", "2GB"); err != nil || opt.SplitSize != 2<<30 {
+		t.Errorf("Unexpected split size: %v.\n", err)
+	}
+	if _, err := NewOption(0, 20, "", "week"); err == nil {
+		t.Errorf("Expect error of invalid split.\n")
+	}
+
+	day := time.Date(2017, 1, 30, 0, 0, 0, 0, time.UTC)
+	days := []time.Time{day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), day.AddDate(0, 2, 2)}
+	for _, c := range []struct {
+		opt   *Option
+		files map[string]uint32 // modeled bars of each file
+	}{
+		// the prolog bar of Jan 30 is kept with Jan 31
+		{&Option{Split: SplitMonth, From: uint32(days[1].Unix())}, map[string]uint32{"2017-01": 1, "2017-02": 1, "2017-04": 1}},
+		{&Option{Split: SplitQuarter}, map[string]uint32{"2017-Q1": 3, "2017-Q2": 1}},
+		{&Option{Split: SplitYear}, map[string]uint32{"2017": 4}},
+		{&Option{SplitSize: int64(headerSize + 6*tickSize)}, map[string]uint32{"001": 2, "002": 2}},
+	} {
+		folder := filepath.Join(dest, fmt.Sprintf("%s%d", c.opt.Split, c.opt.SplitSize))
+		os.MkdirAll(folder, 0777)
+
+		fxt := NewFxtFile(1440, "EURUSD", folder, c.opt)
+		for _, bar := range days {
+			fxt.PackTicks(uint32(bar.Unix()), barTicks(bar, 1.05100, 1.05200, 1.05000))
+		}
+		if err := fxt.Finish(); err != nil {
+			t.Fatalf("Finish fxt failed: %v.\n", err)
+		}
+
+		names, _ := filepath.Glob(filepath.Join(folder, "*.fxt"))
+		if len(names) != len(c.files) {
+			t.Errorf("Split %+v expect %d files, got %v.\n", c.opt, len(c.files), names)
+		}
+		for key, bars := range c.files {
+			fpath := filepath.Join(folder, PartName("EURUSD", 1440, 0, key))
+			report, err := Verify(fpath)
+			if err != nil {
+				t.Fatalf("Verify %s failed: %v.\n", key, err)
+			}
+			if !report.OK() || report.Header.ModeledBars != bars {
+				t.Errorf("Unexpected report:\n%s", report)
+			}
+			if info, err := os.Stat(fpath); c.opt.SplitSize > 0 && (err != nil || info.Size() > c.opt.SplitSize) {
+				t.Errorf("File %s exceeds split size %d: %v.\n", key, c.opt.SplitSize, info.Size())
+			}
+		}
+	}
+}
+
+// failedDest fail to create the file `name`
+type failedDest struct {
+	core.Destination
+	name string
+}
+
+func (d *failedDest) Create(name string) (io.WriteCloser, error) {
+	if name == d.name {
+		return nil, fmt.Errorf("create %s failed", name)
+	}
+	return d.Destination.Create(name)
+}
+
+func TestFxtSplitError(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	// 2 bars of each file, the second file is failed
+	dst := &failedDest{core.NewFolder(dest), PartName("EURUSD", 1440, 0, "002")}
+	fxt := newFxt(nil, dst, 1440, "EURUSD", &Option{SplitSize: int64(headerSize + 2*tickSize)})
+
+	for idx := 0; idx < 6; idx++ {
+		bar := testDay.AddDate(0, 0, idx)
+		err := fxt.PackTicks(uint32(bar.Unix()), barTicks(bar, 1.05100))
+		// the failure of the second file is found when it's finished by the fifth bar
+		if (idx < 4) != (err == nil) {
+			t.Errorf("Bar %d: unexpected error %v.\n", idx, err)
+		}
+	}
+	if err := fxt.Finish(); err == nil {
+		t.Errorf("Expect error of failed file.\n")
+	}
+
+	report, err := Verify(filepath.Join(dest, PartName("EURUSD", 1440, 0, "001")))
+	if err != nil || !report.OK() || report.Header.ModeledBars != 2 {
+		t.Errorf("Unexpected report of the first file: %v\n%s", err, report)
+	}
+}
+
+func TestFxtTester(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	if _, err := NewTester("", nil); err == nil {
+		t.Errorf("Expect error of empty expert.\n")
+	}
+	if _, err := NewTester("MACD Sample", []string{"Lots"}); err == nil {
+		t.Errorf("Expect error of invalid input.\n")
+	}
+	tester, err := NewTester("MACD Sample.ex4", []string{"Lots=0.1", " TakeProfit = 50", "Comment=a,b"})
+	if err != nil {
+		t.Fatalf("Create tester failed: %v.\n", err)
+	}
+
+	var buf bytes.Buffer
+	tester.WriteSet(&buf)
+	if buf.String() != "Lots=0.1\r\nTakeProfit=50\r\nComment=a,b\r\n" {
+		t.Errorf("Unexpected set file %q.\n", buf.String())
+	}
+
+	fxt := NewFxtFile(240, "EURUSD", dest, &Option{Model: ModelOpenPrices, Spread: 15, Tester: tester, To: uint32(testDay.Unix()) + 86400})
+	fxt.PackTicks(uint32(testDay.Unix()), barTicks(testDay, 1.05100))
+	if err = fxt.Finish(); err != nil {
+		t.Fatalf("Finish fxt failed: %v.\n", err)
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dest, "EURUSD240_2.ini"))
+	if err != nil {
+		t.Fatalf("Read tester ini failed: %v.\n", err)
+	}
+	for _, line := range []string{
+		"TestExpert=MACD Sample", "TestExpertParameters=MACD Sample.set", "TestSymbol=EURUSD", "TestPeriod=H4",
+		"TestModel=2", "TestSpread=15", "TestFromDate=2017.01.02", "TestToDate=2017.01.03", "TestReport=EURUSD240_2",
+	} {
+		if !bytes.Contains(bs, []byte(line+"\r\n")) {
+			t.Errorf("Expect %s in tester ini:\n%s", line, bs)
+		}
+	}
+}
@@ -171,6 +171,28 @@ func NewHeader(version uint32, symbol string, timeframe, spread, model uint32) *
 	return h
 }
 
+// SymbolName in the header
+//
+func (h *FXTHeader) SymbolName() string {
+	return szchar(h.Symbol[:])
+}
+
+// Validate the fields which identify the fxt file
+//
+func (h *FXTHeader) Validate() error {
+	switch {
+	case h.Version != 405:
+		return fmt.Errorf("unsupported fxt version %d", h.Version)
+	case h.SymbolName() == "":
+		return fmt.Errorf("empty symbol in fxt header")
+	case h.Period == 0:
+		return fmt.Errorf("invalid period %d in fxt header", h.Period)
+	case h.ModelType > ModelOpenPrices:
+		return fmt.Errorf("invalid model %d in fxt header", h.ModelType)
+	}
+	return nil
+}
+
 func (h *FXTHeader) ToBytes() ([]byte, error) {
 	bs, err := misc.PackLittleEndian(headerSize, h)
 	if err != nil {
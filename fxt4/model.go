@@ -0,0 +1,90 @@
+package fxt4
+
+import (
+	"errors"
+	"math"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// Models of fxt file
+const (
+	ModelEveryTick     = uint32(0) // every tick
+	ModelControlPoints = uint32(1) // control points, only read, the generator of MT4 is not public
+	ModelOpenPrices    = uint32(2) // open prices only
+)
+
+var errControlPoints = errors.New("fxt model 1 (control points) is not supported")
+
+// ohlcPoints generate the points of one bar from `ticks` within [start, start+seconds):
+// open, low, high, close for bullish bar, or open, high, low, close for bearish bar.
+// The points are placed at even intervals within the bar, the time of the real ticks is not kept,
+// and the volume is split among them.
+//
+func ohlcPoints(start, seconds uint32, ticks []*core.TickData) []*core.TickData {
+	var (
+		first  = ticks[0]
+		last   = ticks[len(ticks)-1]
+		high   = first.Bid
+		low    = first.Bid
+		volume float64
+	)
+	for _, tick := range ticks {
+		high = math.Max(high, tick.Bid)
+		low = math.Min(low, tick.Bid)
+		volume += tick.VolumeBid
+	}
+
+	prices := []float64{first.Bid, low, high, last.Bid}
+	if last.Bid < first.Bid {
+		prices[1], prices[2] = high, low
+	}
+
+	// drop the points with the same price as previous one
+	points := make([]float64, 1, len(prices))
+	points[0] = prices[0]
+	for _, price := range prices[1:] {
+		if price != points[len(points)-1] {
+			points = append(points, price)
+		}
+	}
+
+	var (
+		spread = last.Ask - last.Bid
+		delta  = int64(seconds) * 1000 / int64(len(points))
+		out    = make([]*core.TickData, 0, len(points))
+	)
+	for idx, price := range points {
+		out = append(out, &core.TickData{
+			Symbol:    first.Symbol,
+			Timestamp: int64(start)*1000 + int64(idx)*delta,
+			Bid:       price,
+			Ask:       price + spread,
+			VolumeBid: volume / float64(len(points)),
+			VolumeAsk: volume / float64(len(points)),
+		})
+	}
+	return out
+}
+
+// modelTicks select the ticks of one bar by model
+//
+//	every tick  : all the ticks
+//	open prices : the OHLC points of the bar, the expert is only launched at the first one
+//
+func (f *FxtFile) modelTicks(barTimestamp uint32, ticks []*core.TickData) []*core.TickData {
+	if f.model == ModelOpenPrices {
+		return ohlcPoints(barTimestamp, f.timeframe*60, ticks)
+	}
+	return ticks
+}
+
+// launchExpert flag of the `idx` tick of the bar
+//
+func (f *FxtFile) launchExpert(idx int) uint32 {
+	if f.model == ModelOpenPrices && idx > 0 {
+		// bar is modified, but the expert is not launched
+		return 0
+	}
+	return 3
+}
@@ -0,0 +1,98 @@
+package fxt4
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spread modes of fxt output
+const (
+	SpreadFixed    = "fixed"    // fixed spread in header
+	SpreadVariable = "variable" // spread of each tick in volume field
+)
+
+// Split periods of fxt output
+const (
+	SplitMonth   = "month"
+	SplitQuarter = "quarter"
+	SplitYear    = "year"
+)
+
+// Option of fxt output
+//
+type Option struct {
+	Model      uint32  // 0 or 2, control points are not generated
+	Spread     uint32  // fixed spread in points
+	SpreadMode string  // fixed or variable
+	Spec       *Spec   // contract specification, default of symbol if nil
+	From       uint32  // tester start date, the bars before it are saved as prolog
+	To         uint32  // tester end date, the date of last bar if 0
+	Split      string  // split files by month, quarter, year or empty
+	SplitSize  int64   // max bytes of each split file, 0 for no limit
+	Tester     *Tester // tester ini saved besides each fxt file if not nil
+}
+
+// NewOption check command line values, fixed spread is used by default.
+// `split` is one of month/quarter/year or size like 500MB, 2GB.
+//
+func NewOption(model, spread uint32, spreadMode, split string) (*Option, error) {
+	opt := &Option{
+		Model:      model,
+		Spread:     spread,
+		SpreadMode: SpreadFixed,
+	}
+
+	if model > ModelOpenPrices {
+		return nil, fmt.Errorf("invalid fxt model: %d", model)
+	}
+	if model == ModelControlPoints {
+		return nil, errControlPoints
+	}
+
+	switch spreadMode = strings.ToLower(spreadMode); spreadMode {
+	case "":
+		break
+	case SpreadFixed, SpreadVariable:
+		opt.SpreadMode = spreadMode
+	default:
+		return nil, fmt.Errorf("invalid fxt spread mode: %s", spreadMode)
+	}
+
+	switch split = strings.ToLower(strings.TrimSpace(split)); split {
+	case "":
+		break
+	case SplitMonth, SplitQuarter, SplitYear:
+		opt.Split = split
+	default:
+		unit := int64(1 << 20)
+		switch {
+		case strings.HasSuffix(split, "gb"):
+			unit = 1 << 30
+			split = strings.TrimSuffix(split, "gb")
+		case strings.HasSuffix(split, "mb"):
+			split = strings.TrimSuffix(split, "mb")
+		}
+		n, err := strconv.ParseInt(split, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid fxt split value: %s", split)
+		}
+		opt.SplitSize = n * unit
+	}
+	return opt, nil
+}
+
+// partKey return the split key of bar time in seconds
+func (o *Option) partKey(barTimestamp uint32) string {
+	tm := time.Unix(int64(barTimestamp), 0).UTC()
+	switch o.Split {
+	case SplitMonth:
+		return tm.Format("2006-01")
+	case SplitQuarter:
+		return fmt.Sprintf("%d-Q%d", tm.Year(), (int(tm.Month())+2)/3)
+	case SplitYear:
+		return tm.Format("2006")
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package fxt4
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader read MT4 tester file .fxt of version 405
+//
+type Reader struct {
+	fpath  string
+	header FXTHeader
+	f      *os.File
+	r      *bufio.Reader
+	bs     []byte
+}
+
+// NewReader open fxt file and parse the header
+//
+func NewReader(fpath string) (*Reader, error) {
+	f, err := os.OpenFile(fpath, os.O_RDONLY, 666)
+	if err != nil {
+		log.Error("Open fxt file %s failed: %v.", fpath, err)
+		return nil, err
+	}
+
+	r := &Reader{
+		fpath: fpath,
+		f:     f,
+		r:     bufio.NewReader(f),
+		bs:    make([]byte, tickSize),
+	}
+
+	h, err := ReadHeader(r.r)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+	r.header = *h
+	return r, nil
+}
+
+// ReadHeader read and decode fxt header from `r`
+//
+func ReadHeader(r io.Reader) (*FXTHeader, error) {
+	var h FXTHeader
+	bs := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, bs[:]); err != nil {
+		return nil, fmt.Errorf("read fxt header failed: %v", err)
+	}
+	if err := binary.Read(bytes.NewBuffer(bs[:]), binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("decode fxt header failed: %v", err)
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Header of the fxt file
+//
+func (r *Reader) Header() *FXTHeader {
+	return &r.header
+}
+
+// Read next tick, return io.EOF at the end of file
+//
+func (r *Reader) Read() (*FxtTick, error) {
+	n, err := io.ReadFull(r.r, r.bs[:])
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tick data failed: %d:%v", n, err)
+	}
+
+	tick := &FxtTick{}
+	if err = binary.Read(bytes.NewBuffer(r.bs[:]), binary.LittleEndian, tick); err != nil {
+		return nil, fmt.Errorf("decode tick data failed: %v", err)
+	}
+	return tick, nil
+}
+
+// Close the fxt file
+//
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
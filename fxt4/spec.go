@@ -0,0 +1,388 @@
+package fxt4
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/misc"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Spec is the contract specification of symbol saved in fxt header.
+// The keys of spec file and `Set` are the json tags.
+//
+type Spec struct {
+	Server         string  `json:"server"`             // account server name
+	BaseCurrency   string  `json:"base_currency"`      // base currency
+	MarginCurrency string  `json:"margin_currency"`    // margin currency
+	Digits         uint32  `json:"digits"`             // digits after decimal point
+	Point          float64 `json:"point"`              // point size, 10^-digits if only digits is given
+	Spread         uint32  `json:"spread"`             // spread in points, -spread is used if 0
+	StopsLevel     uint32  `json:"stops_level"`        // stop distance in points
+	FreezeLevel    uint32  `json:"freeze_level"`       // freeze distance in points
+	PendingsGTC    uint32  `json:"pendings_gtc"`       // 1 if pending orders are GTC
+	MinLot         float64 `json:"min_lot"`            // min lot size
+	MaxLot         float64 `json:"max_lot"`            // max lot size
+	LotStep        float64 `json:"lot_step"`           // lot step
+	ContractSize   float64 `json:"contract_size"`      // units of one lot
+	TickValue      float64 `json:"tick_value"`         // tick value in quote currency
+	TickSize       float64 `json:"tick_size"`          // tick size
+	ProfitMode     uint32  `json:"profit_mode"`        // 0=Forex|1=CFD|2=Futures
+	SwapEnabled    uint32  `json:"swap_enabled"`       // 1 if swaps are applied
+	SwapMode       int32   `json:"swap_mode"`          // 0=Points|1=BaseCurrency|2=Interest|3=MarginCurrency
+	SwapLong       float64 `json:"swap_long"`          // long overnight swap
+	SwapShort      float64 `json:"swap_short"`         // short overnight swap
+	TripleRollover uint32  `json:"triple_rollover"`    // weekday of triple swaps
+	Leverage       uint32  `json:"leverage"`           // account leverage
+	FreeMarginMode uint32  `json:"free_margin_mode"`   // free margin calculation type
+	MarginMode     uint32  `json:"margin_mode"`        // 0=Forex|1=CFD|2=Futures|3=CFD Index|4=CFD Leverage
+	StopoutLevel   uint32  `json:"stopout_level"`      // margin stopout level
+	StopoutMode    uint32  `json:"stopout_mode"`       // 0=Percent|1=Money
+	MarginInit     float64 `json:"margin_init"`        // initial margin requirement
+	MarginMaintain float64 `json:"margin_maintenance"` // maintenance margin requirement
+	MarginHedged   float64 `json:"margin_hedged"`      // hedged margin requirement
+	MarginDivider  float64 `json:"margin_divider"`     // leverage calculation
+	Commission     float64 `json:"commission"`         // commission rate
+	CommissionMode int32   `json:"commission_mode"`    // 0=Money|1=Pips|2=Percent
+	CommissionType int32   `json:"commission_type"`    // 0=RoundTurn|1=PerDeal
+}
+
+// NewSpec return the default specification of `symbol`, which is the same as the predefined header
+//
+func NewSpec(symbol string) *Spec {
+	digits := core.Digits(symbol)
+	currency := symbol
+	if len(currency) > 3 {
+		currency = currency[:3]
+	}
+
+	return &Spec{
+		Server:         "Beijing MoreU Tech.",
+		BaseCurrency:   currency,
+		MarginCurrency: currency,
+		Digits:         uint32(digits),
+		Point:          math.Pow10(-digits),
+		StopsLevel:     10,
+		PendingsGTC:    1,
+		MinLot:         0.01,
+		MaxLot:         500,
+		LotStep:        0.01,
+		ContractSize:   100000,
+		TripleRollover: 3,
+		Leverage:       100,
+		FreeMarginMode: 1,
+		StopoutLevel:   30,
+		MarginHedged:   50000,
+		MarginDivider:  1.25,
+		CommissionMode: 1,
+	}
+}
+
+// LoadSpec load the specification of `symbol` from json, yaml or ini file, the values not given are default.
+//
+// The json file is an object of symbols:
+//
+//	{"EURUSD": {"leverage": 500, "swap_long": -2.5}}
+//
+// The yaml file is a mapping of symbols in the same way:
+//
+//	EURUSD:
+//	  leverage: 500
+//
+// The ini file has one section per symbol, the keys before any section apply to all symbols,
+// the sections are optional if the file is only for one symbol:
+//
+//	server = Broker-Live
+//	[EURUSD]
+//	leverage = 500
+//
+func LoadSpec(fpath, symbol string) (*Spec, error) {
+	spec := NewSpec(symbol)
+	if err := spec.Load(fpath, symbol); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Load the values of `symbol` from json, yaml, ini or MT4 symbols.raw file, the values not given are unchanged.
+// The symbol keys and sections are matched case insensitively.
+//
+func (s *Spec) Load(fpath, symbol string) error {
+	symbol = strings.ToUpper(symbol)
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".json":
+		return s.loadJSON(fpath, symbol)
+	case ".yaml", ".yml":
+		return s.loadYAML(fpath, symbol)
+	case ".ini":
+		return s.loadINI(fpath, symbol)
+	case ".raw":
+		sym, err := FindSymbol(fpath, symbol)
+		if err != nil {
+			return err
+		}
+		sym.Apply(s)
+		return nil
+	}
+	return fmt.Errorf("unsupported spec file %s, json, yaml, ini or symbols.raw is required", fpath)
+}
+
+func (s *Spec) loadJSON(fpath, symbol string) error {
+	bs, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	symbols := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(bs, &symbols); err != nil {
+		return fmt.Errorf("decode %s failed: %v", fpath, err)
+	}
+	var raw json.RawMessage
+	for key, value := range symbols {
+		if strings.ToUpper(key) == symbol {
+			raw = value
+			break
+		}
+	}
+	if raw == nil {
+		return fmt.Errorf("symbol %s not found in %s", symbol, fpath)
+	}
+
+	digits, point := s.Digits, s.Point
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(s); err != nil {
+		return fmt.Errorf("decode %s of %s failed: %v", symbol, fpath, err)
+	}
+	s.derivePoint(digits, point)
+	return nil
+}
+
+func (s *Spec) loadYAML(fpath, symbol string) error {
+	bs, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	symbols := make(map[string]map[string]interface{})
+	if err = yaml.Unmarshal(bs, &symbols); err != nil {
+		return fmt.Errorf("decode %s failed: %v", fpath, err)
+	}
+	var values map[string]interface{}
+	for key, value := range symbols {
+		if strings.ToUpper(key) == symbol {
+			values = value
+			break
+		}
+	}
+	if values == nil {
+		return fmt.Errorf("symbol %s not found in %s", symbol, fpath)
+	}
+
+	// digits first, so the point given in any order is kept
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key == "digits" {
+			keys = append([]string{key}, keys...)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if err = s.Set(fmt.Sprintf("%s=%v", key, values[key])); err != nil {
+			return fmt.Errorf("%s: %s: %v", fpath, symbol, err)
+		}
+	}
+	return nil
+}
+
+func (s *Spec) loadINI(fpath, symbol string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		found    bool
+		sections bool
+		section  string
+		lineNo   int
+		scanner  = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.ToUpper(strings.TrimSpace(line[1 : len(line)-1]))
+			found = found || section == symbol
+			sections = true
+			continue
+		}
+		if section != "" && section != symbol {
+			continue
+		}
+		if err = s.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", fpath, lineNo, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if sections && !found {
+		return fmt.Errorf("symbol %s not found in %s", symbol, fpath)
+	}
+	return nil
+}
+
+// Set one value by `key=value`, key is the json tag
+//
+func (s *Spec) Set(kv string) error {
+	ss := strings.SplitN(kv, "=", 2)
+	if len(ss) != 2 {
+		return fmt.Errorf("invalid spec value: %s", kv)
+	}
+	key, value := strings.ToLower(strings.TrimSpace(ss[0])), strings.TrimSpace(ss[1])
+
+	digits, point := s.Digits, s.Point
+	defer s.derivePoint(digits, point)
+
+	v := reflect.ValueOf(s).Elem()
+	for idx := 0; idx < v.NumField(); idx++ {
+		if v.Type().Field(idx).Tag.Get("json") != key {
+			continue
+		}
+
+		var err error
+		field := v.Field(idx)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Uint32:
+			var n uint64
+			if n, err = strconv.ParseUint(value, 10, 32); err == nil {
+				field.SetUint(n)
+			}
+		case reflect.Int32:
+			var n int64
+			if n, err = strconv.ParseInt(value, 10, 32); err == nil {
+				field.SetInt(n)
+			}
+		case reflect.Float64:
+			var n float64
+			if n, err = strconv.ParseFloat(value, 64); err == nil {
+				field.SetFloat(n)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid spec value of %s: %s", key, value)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown spec key: %s", key)
+}
+
+// derivePoint follow the changed digits by point, unless point was given with a different value
+func (s *Spec) derivePoint(digits uint32, point float64) {
+	if s.Digits != digits && s.Point == point && point == math.Pow10(-int(digits)) {
+		s.Point = math.Pow10(-int(s.Digits))
+	}
+}
+
+// Validate the values which are checked by the tester
+//
+func (s *Spec) Validate() error {
+	switch {
+	case len(s.Server) >= 128:
+		return fmt.Errorf("server name is too long: %s", s.Server)
+	case len(s.BaseCurrency) == 0 || len(s.BaseCurrency) >= 12:
+		return fmt.Errorf("invalid base currency: %s", s.BaseCurrency)
+	case len(s.MarginCurrency) == 0 || len(s.MarginCurrency) >= 12:
+		return fmt.Errorf("invalid margin currency: %s", s.MarginCurrency)
+	case s.Digits > 8:
+		return fmt.Errorf("invalid digits: %d", s.Digits)
+	case s.Point <= 0 || math.Abs(s.Point-math.Pow10(-int(s.Digits))) > 1e-12:
+		return fmt.Errorf("point %v doesn't match digits %d", s.Point, s.Digits)
+	case s.MinLot <= 0 || s.MaxLot < s.MinLot || s.LotStep <= 0:
+		return fmt.Errorf("invalid lot size: min %v, max %v, step %v", s.MinLot, s.MaxLot, s.LotStep)
+	case s.ContractSize <= 0:
+		return fmt.Errorf("invalid contract size: %v", s.ContractSize)
+	case s.ProfitMode > 2:
+		return fmt.Errorf("invalid profit mode: %d", s.ProfitMode)
+	case s.SwapMode < 0 || s.SwapMode > 3:
+		return fmt.Errorf("invalid swap mode: %d", s.SwapMode)
+	case s.TripleRollover > 6:
+		return fmt.Errorf("invalid triple rollover day: %d", s.TripleRollover)
+	case s.Leverage == 0:
+		return fmt.Errorf("invalid leverage: %d", s.Leverage)
+	case s.MarginMode > 4:
+		return fmt.Errorf("invalid margin mode: %d", s.MarginMode)
+	case s.StopoutMode > 1:
+		return fmt.Errorf("invalid stopout mode: %d", s.StopoutMode)
+	case s.CommissionMode < 0 || s.CommissionMode > 2:
+		return fmt.Errorf("invalid commission mode: %d", s.CommissionMode)
+	case s.CommissionType < 0 || s.CommissionType > 1:
+		return fmt.Errorf("invalid commission type: %d", s.CommissionType)
+	}
+	return nil
+}
+
+// Apply the specification to fxt header
+//
+func (s *Spec) Apply(h *FXTHeader) {
+	if s.Spread > 0 {
+		h.Spread = s.Spread
+	}
+	h.Digits = s.Digits
+	h.PointSize = s.Point
+	h.MinLotsize = uint32(s.MinLot*100 + 0.5)
+	h.MaxLotsize = uint32(s.MaxLot*100 + 0.5)
+	h.LotStepsize = uint32(s.LotStep*100 + 0.5)
+	h.StopsLevel = s.StopsLevel
+	h.FreezeDistance = s.FreezeLevel
+	h.PendingsGTC = s.PendingsGTC
+
+	h.ContractSize = s.ContractSize
+	h.TickValue = s.TickValue
+	h.TickSize = s.TickSize
+	h.ProfitCalculationMode = s.ProfitMode
+
+	h.SwapEnabled = s.SwapEnabled
+	h.SwapCalculationMode = s.SwapMode
+	h.SwapLongValue = s.SwapLong
+	h.SwapShortValue = s.SwapShort
+	h.TripleRolloverDay = s.TripleRollover
+
+	h.AccountLeverage = s.Leverage
+	h.FreeMarginCalculationType = s.FreeMarginMode
+	h.MarginCalculationMode = s.MarginMode
+	h.MarginStopoutLevel = s.StopoutLevel
+	h.MarginStopoutType = s.StopoutMode
+	h.MarginInit = s.MarginInit
+	h.MarginMaintenance = s.MarginMaintain
+	h.MarginHedged = s.MarginHedged
+	h.MarginDivider = s.MarginDivider
+
+	h.CommissionValue = s.Commission
+	h.CommissionCalculationMode = s.CommissionMode
+	h.CommissionType = s.CommissionType
+
+	h.ServerName = [128]byte{}
+	h.BaseCurrency = [12]byte{}
+	h.MarginCurrency = [12]byte{}
+	misc.ToFixBytes(h.ServerName[:], s.Server)
+	misc.ToFixBytes(h.BaseCurrency[:], s.BaseCurrency)
+	misc.ToFixBytes(h.MarginCurrency[:], s.MarginCurrency)
+}
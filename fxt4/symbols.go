@@ -0,0 +1,173 @@
+package fxt4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+var (
+	symbolSize = 1936
+)
+
+// Symbol is one record of MT4 `history/<server>/symbols.raw` (1936 bytes).
+// Only the fields of contract specification are decoded, the others are skipped.
+//
+// Refer: https://github.com/rosasurfer/mt4-expander (struct SYMBOL)
+//
+type Symbol struct {
+	Name            [12]byte   //    0   12   symbol name (szchar)
+	Description     [64]byte   //   12   64   symbol description (szchar)
+	Origin          [12]byte   //   76   12   origin symbol of custom symbol (szchar)
+	AltName         [12]byte   //   88   12   alternative name (szchar)
+	BaseCurrency    [12]byte   //  100   12   base currency (szchar)
+	Group           uint32     //  112    4   index in symgroups.raw
+	Digits          uint32     //  116    4   digits
+	TradeMode       uint32     //  120    4   0=No|1=CloseOnly|2=Full
+	BackgroundColor uint32     //  124    4   color in MarketWatch window
+	ArrayKey        uint32     //  128    4   unique id
+	ID              uint32     //  132    4   id in symbols.sel
+	_               [1184]byte //  136 1184   sessions and unknown
+	Spread          uint32     // 1320    4   spread in points, 0 for variable spread
+	_               [12]byte   // 1324   12
+	SwapEnabled     uint32     // 1336    4   if swaps are applied
+	SwapType        int32      // 1340    4   0=Points|1=BaseCurrency|2=Interest|3=MarginCurrency
+	SwapLong        float64    // 1344    8   long overnight swap
+	SwapShort       float64    // 1352    8   short overnight swap
+	SwapRolloverDay uint32     // 1360    4   weekday of triple swaps
+	_               [4]byte    // 1364    4
+	ContractSize    float64    // 1368    8   units of one lot
+	_               [16]byte   // 1376   16
+	StopsLevel      uint32     // 1392    4   stop distance in points
+	_               [12]byte   // 1396   12
+	MarginCalcMode  uint32     // 1408    4   0=Forex|1=CFD|2=Futures|3=CFD Index|4=CFD Leverage
+	_               [4]byte    // 1412    4
+	MarginInit      float64    // 1416    8   initial margin requirement
+	MarginMaintain  float64    // 1424    8   maintenance margin requirement
+	MarginHedged    float64    // 1432    8   hedged margin requirement
+	MarginDivider   float64    // 1440    8   leverage calculation
+	PointSize       float64    // 1448    8   point size
+	PointsPerUnit   float64    // 1456    8   1 / point size
+	_               [24]byte   // 1464   24
+	MarginCurrency  [12]byte   // 1488   12   margin currency (szchar)
+	_               [104]byte  // 1500  104
+	ProfitCalcMode  uint32     // 1604    4   0=Forex|1=CFD|2=Futures
+	_               [328]byte  // 1608  328
+}
+
+func szchar(bs []byte) string {
+	if idx := bytes.IndexByte(bs, 0); idx >= 0 {
+		bs = bs[:idx]
+	}
+	return string(bs)
+}
+
+// SymbolName of the record
+//
+func (s *Symbol) SymbolName() string {
+	return szchar(s.Name[:])
+}
+
+// Validate the decoded values, which fails if the file is not symbols.raw of MT4 build 600+
+//
+func (s *Symbol) Validate() error {
+	switch {
+	case s.SymbolName() == "":
+		return fmt.Errorf("empty symbol name")
+	case s.Digits > 8:
+		return fmt.Errorf("invalid digits %d of %s", s.Digits, s.SymbolName())
+	case s.PointSize <= 0 || math.Abs(s.PointSize-math.Pow10(-int(s.Digits))) > 1e-12:
+		return fmt.Errorf("point %v doesn't match digits %d of %s", s.PointSize, s.Digits, s.SymbolName())
+	case s.ContractSize <= 0:
+		return fmt.Errorf("invalid contract size %v of %s", s.ContractSize, s.SymbolName())
+	}
+	return nil
+}
+
+// Apply the contract specification of symbols.raw to `spec`, the others are not changed
+//
+func (s *Symbol) Apply(spec *Spec) {
+	if currency := szchar(s.BaseCurrency[:]); currency != "" {
+		spec.BaseCurrency = currency
+	}
+	if currency := szchar(s.MarginCurrency[:]); currency != "" {
+		spec.MarginCurrency = currency
+	}
+	spec.Digits = s.Digits
+	spec.Point = s.PointSize
+	spec.Spread = s.Spread
+	spec.StopsLevel = s.StopsLevel
+	spec.ContractSize = s.ContractSize
+	spec.ProfitMode = s.ProfitCalcMode
+	spec.SwapEnabled = s.SwapEnabled
+	spec.SwapMode = s.SwapType
+	spec.SwapLong = s.SwapLong
+	spec.SwapShort = s.SwapShort
+	spec.TripleRollover = s.SwapRolloverDay
+	spec.MarginMode = s.MarginCalcMode
+	spec.MarginInit = s.MarginInit
+	spec.MarginMaintain = s.MarginMaintain
+	spec.MarginHedged = s.MarginHedged
+	spec.MarginDivider = s.MarginDivider
+}
+
+// ReadSymbols read all the records of symbols.raw
+//
+func ReadSymbols(fpath string) ([]*Symbol, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	symbols := make([]*Symbol, 0)
+	bs := make([]byte, symbolSize)
+	for {
+		if _, err = io.ReadFull(f, bs); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("read %s failed: %v", fpath, err)
+		}
+
+		s := &Symbol{}
+		if err = binary.Read(bytes.NewReader(bs), binary.LittleEndian, s); err != nil {
+			return nil, fmt.Errorf("decode %s failed: %v", fpath, err)
+		}
+		symbols = append(symbols, s)
+	}
+	return symbols, nil
+}
+
+// FindSymbol read the record of `symbol` from symbols.raw, the broker suffix like `EURUSD.pro` is matched too
+//
+func FindSymbol(fpath, symbol string) (*Symbol, error) {
+	symbols, err := ReadSymbols(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Symbol
+	symbol = strings.ToUpper(symbol)
+	for _, s := range symbols {
+		name := strings.ToUpper(s.SymbolName())
+		if name == symbol {
+			found = s
+			break
+		}
+		if found == nil && strings.HasPrefix(name, symbol) {
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("symbol %s not found in %s", symbol, fpath)
+	}
+	if err = found.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+	return found, nil
+}
@@ -0,0 +1,106 @@
+package fxt4
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	inputRegx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Tester is the strategy tester configuration of MT4, which is saved as `terminal.exe /config:` ini file
+// besides each fxt file. Symbol, period, model, spread and dates are taken from the fxt header.
+//
+// Refer: https://www.metatrader4.com/en/trading-platform/help/service/start_conf_file
+//
+type Tester struct {
+	Expert  string   // expert name under MQL4/Experts, without extension
+	SetFile string   // expert parameters file under tester folder, `Expert.set` by default
+	Inputs  []string // expert inputs like `Lots=0.1`, saved into SetFile
+}
+
+// NewTester check command line values, each of `inputs` is one expert input like `Lots=0.1`,
+// the value may contain comma
+//
+func NewTester(expert string, inputs []string) (*Tester, error) {
+	expert = strings.TrimSpace(expert)
+	if expert == "" || strings.ContainsAny(expert, `/\:`) {
+		return nil, fmt.Errorf("invalid tester expert: %s", expert)
+	}
+	expert = strings.TrimSuffix(strings.TrimSuffix(expert, ".ex4"), ".mq4")
+
+	t := &Tester{
+		Expert:  expert,
+		SetFile: expert + ".set",
+		Inputs:  make([]string, 0, len(inputs)),
+	}
+	for _, kv := range inputs {
+		ss := strings.SplitN(kv, "=", 2)
+		if len(ss) != 2 || !inputRegx.MatchString(strings.TrimSpace(ss[0])) {
+			return nil, fmt.Errorf("invalid expert input: %s", kv)
+		}
+		t.Inputs = append(t.Inputs, strings.TrimSpace(ss[0])+"="+strings.TrimSpace(ss[1]))
+	}
+	return t, nil
+}
+
+// periodName of timeframe in minutes, like M15, H1, D1, W1, MN1
+func periodName(timeframe uint32) string {
+	switch {
+	case timeframe >= 30*24*60:
+		return fmt.Sprintf("MN%d", timeframe/(30*24*60))
+	case timeframe == 7*24*60:
+		return "W1"
+	case timeframe%(24*60) == 0:
+		return fmt.Sprintf("D%d", timeframe/(24*60))
+	case timeframe%60 == 0:
+		return fmt.Sprintf("H%d", timeframe/60)
+	}
+	return fmt.Sprintf("M%d", timeframe)
+}
+
+// WriteINI write the tester configuration of fxt header `h`, the report is saved as `report`.htm by MT4
+//
+func (t *Tester) WriteINI(w io.Writer, h *FXTHeader, report string) error {
+	date := func(ts uint32) string {
+		return time.Unix(int64(ts), 0).UTC().Format("2006.01.02")
+	}
+
+	bw := bufio.NewWriter(w)
+	lines := []string{
+		"; strategy tester of " + report + ".fxt",
+		"TestExpert=" + t.Expert,
+		"TestExpertParameters=" + t.SetFile,
+		"TestSymbol=" + h.SymbolName(),
+		"TestPeriod=" + periodName(h.Period),
+		fmt.Sprintf("TestModel=%d", h.ModelType),
+		fmt.Sprintf("TestSpread=%d", h.Spread),
+		"TestOptimization=false",
+		"TestDateEnable=true",
+		"TestFromDate=" + date(h.TesterSettingFrom),
+		"TestToDate=" + date(h.TesterSettingTo),
+		"TestReport=" + report,
+		"TestReplaceReport=true",
+		"TestShutdownTerminal=true",
+		"TestVisualEnable=false",
+	}
+	for _, line := range lines {
+		bw.WriteString(line + "\r\n")
+	}
+	return bw.Flush()
+}
+
+// WriteSet write the expert inputs as set file
+//
+func (t *Tester) WriteSet(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, kv := range t.Inputs {
+		bw.WriteString(kv + "\r\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,240 @@
+package fxt4
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+var (
+	// MaxIssues is the max number of issues kept in the report, the others are only counted
+	MaxIssues = 100
+	// MaxGapMinutes is the longest gap without ticks which is counted as missing data,
+	// the longer ones are taken as market closed
+	MaxGapMinutes = uint32(60)
+	// SpikeRatio is the max change of price between two ticks, the larger ones are reported as spikes
+	SpikeRatio = 0.1
+)
+
+// Report of fxt verification
+//
+type Report struct {
+	File      string
+	Header    FXTHeader
+	Bars      uint32   // number of bars in the file
+	Ticks     int64    // number of ticks in the file
+	FirstBar  uint32   // time of the first bar
+	LastBar   uint32   // time of the last bar
+	FirstTick uint32   // time of the first tick
+	LastTick  uint32   // time of the last tick
+	Minutes   uint32   // minutes with ticks
+	Missing   uint32   // minutes without ticks within the gaps shorter than MaxGapMinutes
+	Quality   float64  // estimated modelling quality, 0 if not applicable
+	Errors    int      // number of issues
+	Issues    []string // the first MaxIssues issues
+}
+
+// issue record one problem of the file
+func (r *Report) issue(format string, args ...interface{}) {
+	r.Errors++
+	if len(r.Issues) < MaxIssues {
+		r.Issues = append(r.Issues, fmt.Sprintf(format, args...))
+	}
+}
+
+// OK return true if no issue is found
+//
+func (r *Report) OK() bool {
+	return r.Errors == 0
+}
+
+// String of the report in text lines
+//
+func (r *Report) String() string {
+	h := &r.Header
+	quality := "n/a"
+	if h.ModelType == ModelEveryTick {
+		quality = fmt.Sprintf("%.1f%%", r.Quality)
+	}
+
+	s := fmt.Sprintf("File: %s\n", r.File)
+	s += fmt.Sprintf("Symbol: %s, Period: %d, Model: %d, Spread: %d, Digits: %d\n",
+		h.SymbolName(), h.Period, h.ModelType, h.Spread, h.Digits)
+	s += fmt.Sprintf("Bars: %d, Ticks: %d, Bar: %s - %s, Tick: %s - %s\n",
+		r.Bars, r.Ticks, timeStr(r.FirstBar), timeStr(r.LastBar), timeStr(r.FirstTick), timeStr(r.LastTick))
+	s += fmt.Sprintf("Minutes: %d, Missing: %d, Modelling quality: %s (header %.1f%%)\n",
+		r.Minutes, r.Missing, quality, h.ModelQuality)
+	for _, issue := range r.Issues {
+		s += fmt.Sprintf("  %s\n", issue)
+	}
+	if r.Errors > len(r.Issues) {
+		s += fmt.Sprintf("  ... %d more issues\n", r.Errors-len(r.Issues))
+	}
+	s += fmt.Sprintf("Errors: %d\n", r.Errors)
+	return s
+}
+
+// Verify check the fxt file `fpath`, the problems are returned as issues of the report,
+// error is returned only if the file can't be read.
+//
+//	header : model, file name (FileName or PartName), bar count, first/last bar times (offset 216), first/last bar index,
+//	         tester dates (offset 472) and model errors
+//	ticks  : monotonic timestamps, BarTimestamp <= TickTimestamp, bar alignment to period
+//	prices : positive, Low <= Open, Close <= High, running open/high/low of the bar, spikes
+//
+// The modelling quality is estimated for every tick model only, as the percentage of minutes with ticks after prolog
+// among the minutes expected within the trading time (gaps longer than MaxGapMinutes are excluded), max 99.9.
+//
+func Verify(fpath string) (*Report, error) {
+	r, err := NewReader(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	report := &Report{
+		File:   fpath,
+		Header: *r.Header(),
+	}
+	h := &report.Header
+
+	name := FileName(h.SymbolName(), h.Period, h.ModelType)
+	if base := filepath.Base(fpath); base != name && !strings.HasPrefix(base, strings.TrimSuffix(name, ".fxt")+"-") {
+		report.issue("file name %s doesn't match header, expect %s", base, name)
+	}
+
+	var (
+		prev    *FxtTick
+		minute  uint32
+		modeled uint32 // bars since FirstBarTime
+		prolog  uint32 // bars before FirstBarTime
+		idx     int    // index of the tick in bar
+	)
+	for {
+		tick, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: tick %d: %v", fpath, report.Ticks, err)
+		}
+		report.Ticks++
+
+		bar, ts := uint32(tick.BarTimestamp), tick.TickTimestamp
+		newBar := prev == nil || tick.BarTimestamp != prev.BarTimestamp
+		if newBar {
+			report.Bars++
+			if report.Bars == 1 {
+				report.FirstBar = bar
+				report.FirstTick = ts
+			}
+			if bar >= h.FirstBarTime {
+				modeled++
+			} else {
+				prolog++
+			}
+			idx = 0
+		} else {
+			idx++
+		}
+		report.LastBar, report.LastTick = bar, ts
+		report.check(prev, tick, newBar, idx)
+
+		// minutes with ticks and the missing ones after prolog
+		if m := core.BarTime(ts, 1); bar >= h.FirstBarTime && (report.Minutes == 0 || m > minute) {
+			if report.Minutes > 0 {
+				if gap := (m - minute) / 60; gap > 1 && gap <= MaxGapMinutes {
+					report.Missing += gap - 1
+				}
+			}
+			report.Minutes++
+			minute = m
+		}
+		prev = tick
+	}
+
+	if report.Ticks == 0 || report.Minutes == 0 {
+		report.issue("no modeled tick data")
+		return report, nil
+	}
+	if modeled != h.ModeledBars {
+		report.issue("modeled bars %d in header, but %d bars from %s", h.ModeledBars, modeled, timeStr(h.FirstBarTime))
+	}
+	if h.FirstBarTime < report.FirstBar || h.FirstBarTime > report.LastBar {
+		report.issue("first bar time %s in header is out of bars", timeStr(h.FirstBarTime))
+	}
+	if h.LastBarTime != report.LastBar {
+		report.issue("last bar time %s in header, but %s in file", timeStr(h.LastBarTime), timeStr(report.LastBar))
+	}
+	if h.FirstBar != 0 && h.FirstBar != prolog+1 {
+		report.issue("first bar %d in header, but %d prolog bars in file", h.FirstBar, prolog)
+	}
+	if h.LastBar != 0 && h.LastBar != report.Bars {
+		report.issue("last bar %d in header, but %d bars in file", h.LastBar, report.Bars)
+	}
+	if h.ModelErrors > 0 {
+		report.issue("%d model errors in header", h.ModelErrors)
+	}
+	if h.TesterSettingFrom > h.FirstBarTime || h.TesterSettingTo < h.TesterSettingFrom {
+		report.issue("tester dates %s - %s don't cover the first bar %s",
+			timeStr(h.TesterSettingFrom), timeStr(h.TesterSettingTo), timeStr(h.FirstBarTime))
+	}
+
+	if h.ModelType == ModelEveryTick {
+		report.Quality = 99.9 * float64(report.Minutes) / float64(report.Minutes+report.Missing)
+	}
+	return report, nil
+}
+
+// check one tick against the previous one
+func (r *Report) check(prev, tick *FxtTick, newBar bool, idx int) {
+	h := &r.Header
+	at := fmt.Sprintf("tick %d (%s)", r.Ticks, tick)
+
+	if uint64(tick.TickTimestamp) < tick.BarTimestamp {
+		r.issue("%s: tick time is earlier than bar time", at)
+	}
+	if bar := uint64(core.BarTime(tick.TickTimestamp, h.Period)); bar != tick.BarTimestamp {
+		r.issue("%s: bar time is not aligned to M%d, expect %s", at, h.Period, timeStr(uint32(bar)))
+	}
+	if prev != nil && tick.TickTimestamp < prev.TickTimestamp {
+		r.issue("%s: tick time goes backwards", at)
+	}
+	if prev != nil && tick.BarTimestamp < prev.BarTimestamp {
+		r.issue("%s: bar time goes backwards", at)
+	}
+
+	prices := []float64{tick.Open, tick.High, tick.Low, tick.Close}
+	for _, price := range prices {
+		if !(price > 0) || math.IsInf(price, 0) {
+			r.issue("%s: invalid price %v", at, price)
+			return
+		}
+	}
+	if tick.Low > tick.High || tick.Open < tick.Low || tick.Open > tick.High ||
+		tick.Close < tick.Low || tick.Close > tick.High {
+		r.issue("%s: prices out of bar range", at)
+	}
+
+	if prev == nil {
+		return
+	}
+	if !newBar && (tick.Open != prev.Open || tick.High < prev.High || tick.Low > prev.Low) {
+		r.issue("%s: open/high/low is not the running state of bar", at)
+	}
+	if math.Abs(tick.Close-prev.Close) > prev.Close*SpikeRatio {
+		r.issue("%s: price spike from %v", at, prev.Close)
+	}
+	if h.ModelType == ModelOpenPrices && idx > 0 && tick.LaunchExpert != 0 {
+		r.issue("%s: expert launched within bar of open prices model", at)
+	}
+}
+
+func timeStr(ts uint32) string {
+	return time.Unix(int64(ts), 0).UTC().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,122 @@
+package hst
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// merger aggregate bars of lower timeframe into one output
+type merger struct {
+	out     *HST401
+	bar     *BarData
+	end     uint64
+	count   int
+	spreads uint64
+}
+
+// Convert aggregate the bars read from `r` into higher timeframes of `outs`,
+// like period_converter of MT4. The bars are aligned by the same rules of tick data,
+// and the outputs are finished at the end.
+//
+func Convert(r *Reader, outs ...*HST401) error {
+	period := r.Header().Period
+	merges := make([]*merger, 0, len(outs))
+	for _, out := range outs {
+		if out.timefame < period || out.timefame%period != 0 {
+			for _, o := range outs {
+				o.Finish()
+			}
+			return fmt.Errorf("M%d can't be aggregated from M%d", out.timefame, period)
+		}
+		merges = append(merges, &merger{out: out})
+	}
+
+	var (
+		err   error
+		bar   *BarData
+		count int64
+	)
+	for {
+		if bar, err = r.Read(); err != nil {
+			break
+		}
+		for _, m := range merges {
+			m.merge(bar)
+		}
+		count++
+	}
+	if err == io.EOF {
+		err = nil
+	}
+
+	for _, m := range merges {
+		m.flush()
+		m.out.Finish()
+	}
+	log.Info("Converted %d bars of M%d.", count, period)
+	return err
+}
+
+// merge one bar into current bar, the current bar is saved if `bar` is out of its range
+func (m *merger) merge(bar *BarData) {
+	if m.bar != nil && bar.CTM >= m.end {
+		m.flush()
+	}
+
+	spread := bar.Spread
+	if spread == 0 {
+		spread = m.out.opt.Spread
+	}
+
+	if m.bar == nil {
+		start := core.BarTime(uint32(bar.CTM), m.out.timefame)
+		m.end = uint64(core.NextBarTime(start, m.out.timefame))
+		m.bar = &BarData{
+			CTM:    uint64(start),
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Spread: spread,
+		}
+		m.count, m.spreads = 0, 0
+	}
+
+	b := m.bar
+	b.High = math.Max(b.High, bar.High)
+	b.Low = math.Min(b.Low, bar.Low)
+	b.Close = bar.Close
+	b.Volume += bar.Volume
+	b.RealVolume += bar.RealVolume
+
+	switch m.out.opt.SpreadMode {
+	case SpreadMin:
+		if spread < b.Spread {
+			b.Spread = spread
+		}
+	case SpreadMax:
+		if spread > b.Spread {
+			b.Spread = spread
+		}
+	case SpreadClose:
+		b.Spread = spread
+	case SpreadFixed:
+		b.Spread = m.out.opt.Spread
+	}
+	m.count++
+	m.spreads += uint64(spread)
+}
+
+// flush save the current bar
+func (m *merger) flush() {
+	if m.bar == nil {
+		return
+	}
+	if m.out.opt.SpreadMode == SpreadAvg {
+		m.bar.Spread = uint32((m.spreads + uint64(m.count)/2) / uint64(m.count))
+	}
+	m.out.PackBar(m.bar)
+	m.bar = nil
+}
@@ -2,14 +2,21 @@ package hst
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/adyzng/go-duka/misc"
 )
 
+// Versions of hst format
+const (
+	V400 = uint32(400)
+	V401 = uint32(401)
+)
+
 const (
-	v401        = uint32(401)
 	barBytes    = 60
+	bar400Bytes = 44
 	headerBytes = 148
 )
 
@@ -39,12 +46,60 @@ type BarData struct {
 	RealVolume uint64  //  52   8
 }
 
+// BarData400 wrap the bar data inside hst version 400 (44 Bytes)
+//
+type BarData400 struct {
+	CTM    uint32  //   0   4   current time in seconds
+	Open   float64 //   4   8   O
+	Low    float64 //  12   8   L
+	High   float64 //  20   8   H
+	Close  float64 //  28   8   C
+	Volume float64 //  36   8   V
+}
+
+// BarData convert to the bar of version 401
+//
+func (b *BarData400) BarData() *BarData {
+	return &BarData{
+		CTM:    uint64(b.CTM),
+		Open:   b.Open,
+		High:   b.High,
+		Low:    b.Low,
+		Close:  b.Close,
+		Volume: uint64(b.Volume),
+	}
+}
+
+// NewBar400 convert bar into version 400
+//
+func NewBar400(b *BarData) *BarData400 {
+	return &BarData400{
+		CTM:    uint32(b.CTM),
+		Open:   b.Open,
+		Low:    b.Low,
+		High:   b.High,
+		Close:  b.Close,
+		Volume: float64(b.Volume),
+	}
+}
+
+// ToBytes convert bar data of version 400 to fix bytes array
+//
+func (b *BarData400) ToBytes() ([]byte, error) {
+	bs, err := misc.PackLittleEndian(bar400Bytes, b)
+	if err != nil {
+		log.Error("Failed to convert HST Bar data to bytes array. Error %v.", err)
+		return make([]byte, 0), err
+	}
+	return bs, err
+}
+
 // NewHeader for hst version 401
 //
 func NewHeader(timeframe uint32, symbol string) *Header {
 	h := &Header{
 		TimeSign: uint32(time.Now().UTC().Unix()),
-		Version:  v401,
+		Version:  V401,
 		Period:   timeframe,
 		Digits:   5, // Digits, using the default value of HST format
 	}
@@ -54,6 +109,37 @@ func NewHeader(timeframe uint32, symbol string) *Header {
 	return h
 }
 
+// Validate the header fields which are required to read the bars
+//
+func (h *Header) Validate() error {
+	switch {
+	case h.Version != V400 && h.Version != V401:
+		return fmt.Errorf("unsupported hst version %d", h.Version)
+	case h.SymbolName() == "":
+		return fmt.Errorf("empty symbol in hst header")
+	case h.Period == 0:
+		return fmt.Errorf("invalid period %d in hst header", h.Period)
+	case h.Digits > 10:
+		return fmt.Errorf("invalid digits %d in hst header", h.Digits)
+	}
+	return nil
+}
+
+// BarBytes return the size of each bar in bytes by version
+//
+func (h *Header) BarBytes() int {
+	if h.Version == V400 {
+		return bar400Bytes
+	}
+	return barBytes
+}
+
+// SymbolName of the header without padding zeros
+//
+func (h *Header) SymbolName() string {
+	return strings.TrimRight(string(h.Symbol[:]), "\x00")
+}
+
 // ToBytes convert header to fix bytes array
 //
 func (h *Header) ToBytes() ([]byte, error) {
@@ -88,14 +174,18 @@ func (b *BarData) String() string {
 	)
 }
 
-func (b *BarData) Strings() []string {
+// Strings format bar as MT4 csv fields: date,time, open, high, low, close, volume,
+// the prices with `digits` after decimal point
+//
+func (b *BarData) Strings(digits int) []string {
 	tm := time.Unix(int64(b.CTM), 0).UTC()
+	priceFmt := fmt.Sprintf("%%.%df", digits)
 	return []string{
 		tm.Format("2006.01.02,15:04"),
-		fmt.Sprintf("%.5f", b.Open),
-		fmt.Sprintf("%.5f", b.High),
-		fmt.Sprintf("%.5f", b.Low),
-		fmt.Sprintf("%.5f", b.Close),
+		fmt.Sprintf(priceFmt, b.Open),
+		fmt.Sprintf(priceFmt, b.High),
+		fmt.Sprintf(priceFmt, b.Low),
+		fmt.Sprintf(priceFmt, b.Close),
 		fmt.Sprintf("%d", b.Volume),
 	}
 }
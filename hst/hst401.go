@@ -2,9 +2,9 @@ package hst
 
 import (
 	"fmt"
+	"io"
 	"math"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/adyzng/go-duka/core"
 	"github.com/adyzng/go-duka/misc"
@@ -14,27 +14,71 @@ var (
 	log = misc.NewLogger("HST", 3)
 )
 
-// HST401 MT4 history data format .hst with version 401
+// HST401 MT4 history data format .hst with version 401, or the legacy version 400
 //
 type HST401 struct {
 	header   *Header
-	dest     string
+	w        io.Writer
+	rw       io.ReadWriteSeeker // update mode
+	dst      core.Destination
 	symbol   string
-	spread   uint32
+	opt      *Option
+	point    float64
 	timefame uint32
 	barCount int64
 	chBars   chan *BarData
 	chClose  chan struct{}
 }
 
-// NewHST create a HST convertor
+// FileName of hst file, like EURUSD60.hst
 //
-func NewHST(timefame, spread uint32, symbol, dest string) *HST401 {
+func FileName(symbol string, timeframe uint32) string {
+	return fmt.Sprintf("%s%d.hst", symbol, timeframe)
+}
+
+// NewHST create a HST convertor which save file `FileName` under `dest`,
+// default option is used if `opt` is nil.
+//
+func NewHST(timefame uint32, symbol, dest string, opt *Option) *HST401 {
+	return newHST(nil, nil, core.NewFolder(dest), timefame, symbol, opt)
+}
+
+// NewWriter create a HST convertor which write into `w`, `w` is not closed by Finish
+//
+func NewWriter(w io.Writer, timefame uint32, symbol string, opt *Option) *HST401 {
+	return newHST(w, nil, nil, timefame, symbol, opt)
+}
+
+// NewUpdate create a HST convertor which merge bars into the existing history `rw`.
+// The bars older than the last bar of `rw` are kept, the last bar is replaced if it's
+// converted again, and the bars going backwards are dropped. `rw` is not closed by Finish.
+// The existing history must be the same version.
+//
+func NewUpdate(rw io.ReadWriteSeeker, timefame uint32, symbol string, opt *Option) *HST401 {
+	return newHST(nil, rw, nil, timefame, symbol, opt)
+}
+
+func newHST(w io.Writer, rw io.ReadWriteSeeker, dst core.Destination, timefame uint32, symbol string, opt *Option) *HST401 {
+	if opt == nil {
+		opt, _ = NewOption(0, "", 0)
+	}
+	header := NewHeader(timefame, symbol)
+	header.Version = opt.Version
+
+	digits := core.Digits(symbol)
+	if opt.Digits > 0 {
+		digits = int(opt.Digits)
+	}
+	header.Digits = uint32(digits)
+
 	hst := &HST401{
-		header:   NewHeader(timefame, symbol),
-		dest:     dest,
+		header:   header,
+		w:        w,
+		rw:       rw,
+		dst:      dst,
 		symbol:   symbol,
-		spread:   spread,
+		opt:      opt,
+		point:    math.Pow10(-digits),
 		timefame: timefame,
 		chBars:   make(chan *BarData, 128),
 		chClose:  make(chan struct{}, 1),
@@ -47,36 +91,72 @@ func NewHST(timefame, spread uint32, symbol, dest string) *HST401 {
 // worker goroutine which flust data to disk
 //
 func (h *HST401) worker() error {
-	fname := fmt.Sprintf("%s%d.hst", h.symbol, h.timefame)
-	fpath := filepath.Join(h.dest, fname)
-
-	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 666)
-	if err != nil {
-		log.Error("Failed to create file %s, error %v.", fpath, err)
-		return err
-	}
+	var err error
 
 	defer func() {
-		f.Close()
+		// drain the bars left on error, so PackTicks never blocks
+		for range h.chBars {
+		}
 		close(h.chClose)
 		log.Info("M%d Saved Bar: %d.", h.timefame, h.barCount)
 	}()
 
+	var last *BarData
+	w := h.w
+	switch {
+	case h.rw != nil:
+		if last, err = h.seekUpdate(); err != nil {
+			log.Error("Update HST failed: %v.", err)
+			return err
+		}
+		w = h.rw
+	case w == nil:
+		fname := FileName(h.symbol, h.timefame)
+		f, err := h.dst.Create(fname)
+		if err != nil {
+			log.Error("Failed to create file %s, error %v.", fname, err)
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
 	// write HST header
 	var bs []byte
 
-	if bs, err = h.header.ToBytes(); err != nil {
-		log.Error("Pack HST Header (%v) failed: %v.", h.header, err)
-		return err
-	}
-	if _, err = f.Write(bs[:]); err != nil {
-		log.Error("Write HST Header (%v) failed: %v.", h.header, err)
-		return err
+	if last == nil && h.rw == nil {
+		if bs, err = h.header.ToBytes(); err != nil {
+			log.Error("Pack HST Header (%v) failed: %v.", h.header, err)
+			return err
+		}
+		if _, err = w.Write(bs[:]); err != nil {
+			log.Error("Write HST Header (%v) failed: %v.", h.header, err)
+			return err
+		}
 	}
 
+	var skipped int64
 	for bar := range h.chBars {
-		if bs, err = bar.ToBytes(); err == nil {
-			if _, err = f.Write(bs[:]); err != nil {
+		if last != nil {
+			// never go backwards, the bar at the end is replaced
+			if bar.CTM < last.CTM {
+				skipped++
+				continue
+			}
+			if bar.CTM > last.CTM {
+				if bs, err = h.encode(last); err == nil {
+					_, err = w.Write(bs[:])
+				}
+				if err != nil {
+					log.Error("Rewrite last BarData(%v) failed: %v.", last, err)
+					break
+				}
+			}
+			last = nil
+		}
+
+		if bs, err = h.encode(bar); err == nil {
+			if _, err = w.Write(bs[:]); err != nil {
 				log.Error("Write BarData(%v) failed: %v.", bar, err)
 			}
 		} else {
@@ -85,12 +165,92 @@ func (h *HST401) worker() error {
 		}
 	}
 
+	if skipped > 0 {
+		log.Warn("M%d Skipped %d bars older than the existing history.", h.timefame, skipped)
+	}
 	if err != nil {
 		log.Warn("HST worker return with %v.", err)
 	}
 	return err
 }
 
+// seekUpdate check the existing history and move to the position of its last bar,
+// which is returned to be rewritten or replaced. A new header is written if it's empty.
+//
+func (h *HST401) seekUpdate() (*BarData, error) {
+	size, err := h.rw.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = h.rw.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		bs, err := h.header.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		_, err = h.rw.Write(bs[:])
+		return nil, err
+	}
+
+	header, err := ReadHeader(h.rw)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version != h.header.Version {
+		return nil, fmt.Errorf("history version %d doesn't match %d", header.Version, h.header.Version)
+	}
+	if symbol := header.SymbolName(); symbol != h.symbol || header.Period != h.timefame {
+		return nil, fmt.Errorf("history of %s M%d doesn't match %s M%d", symbol, header.Period, h.symbol, h.timefame)
+	}
+	h.header = header
+
+	barSize := int64(h.header.BarBytes())
+	count := (size - headerBytes) / barSize
+	if (size-headerBytes)%barSize != 0 {
+		log.Warn("Partial bar found at the end of M%d history.", h.timefame)
+		if t, ok := h.rw.(interface{ Truncate(int64) error }); ok {
+			if err = t.Truncate(headerBytes + count*barSize); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if count == 0 {
+		_, err = h.rw.Seek(headerBytes, io.SeekStart)
+		return nil, err
+	}
+
+	offset := headerBytes + (count-1)*barSize
+	if _, err = h.rw.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	bs := make([]byte, barSize)
+	if _, err = io.ReadFull(h.rw, bs); err != nil {
+		return nil, err
+	}
+	last, err := decodeBar(h.header.Version, bs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = h.rw.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	log.Info("M%d Update after %d bars, last bar %s.", h.timefame, count,
+		time.Unix(int64(last.CTM), 0).UTC().Format("2006-01-02 15:04"))
+	return last, nil
+}
+
+// encode bar by the version of header
+func (h *HST401) encode(bar *BarData) ([]byte, error) {
+	if h.header.Version == V400 {
+		return NewBar400(bar).ToBytes()
+	}
+	return bar.ToBytes()
+}
+
 // PackTicks aggregate ticks with timeframe
 //
 func (h *HST401) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
@@ -99,6 +259,32 @@ func (h *HST401) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
 		return nil
 	}
 
+	bar := NewBar(barTimestamp, ticks)
+	bar.Spread = h.opt.BarSpread(ticks, h.point)
+	bar.RealVolume = RealVolume(ticks)
+
+	select {
+	case h.chBars <- bar:
+		//log.Trace("Bar %d: %v.", h.barCount, bar)
+		h.barCount++
+		break
+		//case <-h.close:
+		//	break
+	}
+	return nil
+}
+
+// PackBar save one bar which is already aggregated
+//
+func (h *HST401) PackBar(bar *BarData) error {
+	h.chBars <- bar
+	h.barCount++
+	return nil
+}
+
+// NewBar aggregate ticks within timeframe into one bar by bid price
+//
+func NewBar(barTimestamp uint32, ticks []*core.TickData) *BarData {
 	bar := &BarData{
 		CTM:   uint64(barTimestamp), //uint32(ticks[0].Timestamp / 1000),
 		Open:  ticks[0].Bid,
@@ -115,16 +301,21 @@ func (h *HST401) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
 		totalVol = totalVol + tick.VolumeBid /*+tick.VolumeAsk*/
 	}
 	bar.Volume = uint64(math.Max(totalVol, 1))
+	return bar
+}
 
-	select {
-	case h.chBars <- bar:
-		//log.Trace("Bar %d: %v.", h.barCount, bar)
-		h.barCount++
-		break
-		//case <-h.close:
-		//	break
+// AvgSpread return the average spread of ticks in points
+//
+func AvgSpread(ticks []*core.TickData, point float64) uint32 {
+	if len(ticks) == 0 {
+		return 0
 	}
-	return nil
+
+	var total float64
+	for _, tick := range ticks {
+		total += tick.Ask - tick.Bid
+	}
+	return uint32(math.Max(0, total/float64(len(ticks))/point+0.5))
 }
 
 // Finish HST file convert
@@ -5,10 +5,29 @@ import (
 	"encoding/binary"
 	"encoding/csv"
 	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
 )
 
+// testDay is the day of the tick fixtures
+var testDay = time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// tempDir create a temp folder for the output files, it's removed by the returned func
+func tempDir(t *testing.T) (string, func()) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	return dest, func() { os.RemoveAll(dest) }
+}
+
 func TestHSTHeader(t *testing.T) {
 	header := NewHeader(1, "EURUSD")
 
@@ -28,6 +47,60 @@ func TestHSTHeader(t *testing.T) {
 	}
 }
 
+func TestHSTDigits(t *testing.T) {
+	for _, tt := range []struct {
+		symbol string
+		digits uint32 // Option.Digits
+		expect uint32
+	}{
+		{"EURUSD", 0, 5},
+		{"USDJPY", 0, 3},
+		{"XAUUSD", 0, 3},
+		{"XAUUSD", 2, 2},
+	} {
+		opt, _ := NewOption(0, "", 0)
+		opt.Digits = tt.digits
+
+		var buf bytes.Buffer
+		h := NewWriter(&buf, 60, tt.symbol, opt)
+		h.Finish()
+
+		var header Header
+		if err := binary.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, &header); err != nil {
+			t.Fatalf("Decode header failed: %v.\n", err)
+		}
+		if header.Digits != tt.expect {
+			t.Errorf("%s: expect digits %d in header, got %d.\n", tt.symbol, tt.expect, header.Digits)
+		}
+	}
+}
+
+func TestHSTDump(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	ms := testDay.Unix() * 1000
+
+	var buf bytes.Buffer
+	h := NewWriter(&buf, 60, "USDJPY", nil)
+	h.PackTicks(uint32(testDay.Unix()), []*core.TickData{
+		{Timestamp: ms + 1000, Ask: 117.625, Bid: 117.615, VolumeBid: 1},
+		{Timestamp: ms + 2000, Ask: 117.635, Bid: 117.620, VolumeBid: 1},
+	})
+	h.Finish()
+
+	fpath := filepath.Join(dest, "USDJPY60.hst")
+	if err := ioutil.WriteFile(fpath, buf.Bytes(), 0666); err != nil {
+		t.Fatalf("Write hst file failed: %v.\n", err)
+	}
+
+	var out bytes.Buffer
+	DumpFile(fpath, false, &out)
+	if !strings.Contains(out.String(), "\n2017.01.02,00:00,117.615,117.620,117.615,117.620,2,") {
+		t.Errorf("Unexpected dump:\n%s", out.String())
+	}
+}
+
 func TestLoadHst(t *testing.T) {
 
 	fcsv := `F:\201710\EURUSD1.hst.csv`
@@ -91,8 +164,314 @@ func TestLoadHst(t *testing.T) {
 			break
 		}
 
-		wc.Write(bar.Strings())
+		wc.Write(bar.Strings(int(h.Digits)))
 		//t.Logf("Bar %d: %+v\n", barCount, bar)
 		barCount++
 	}
 }
+
+func TestHSTSource(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	h := NewHST(1, "EURUSD", dest, nil)
+	h.PackTicks(uint32(testDay.Unix()), []*core.TickData{
+		{Timestamp: testDay.Unix()*1000 + 100, Bid: 1.05100, VolumeBid: 1},
+		{Timestamp: testDay.Unix()*1000 + 200, Bid: 1.05000, VolumeBid: 1},
+		{Timestamp: testDay.Unix()*1000 + 300, Bid: 1.05300, VolumeBid: 1},
+		{Timestamp: testDay.Unix()*1000 + 400, Bid: 1.05200, VolumeBid: 1},
+	})
+	h.Finish()
+
+	src, err := NewSource(filepath.Join(dest, "EURUSD1.hst"), 20)
+	if err != nil {
+		t.Fatalf("Open hst source failed: %v.\n", err)
+	}
+	defer src.Close()
+
+	ticks, err := src.Ticks("EURUSD", testDay, testDay.Add(24*time.Hour))
+	if err != nil || len(ticks) != 4 {
+		t.Fatalf("Load ticks failed: %d, %v.\n", len(ticks), err)
+	}
+
+	for idx, bid := range []float64{1.05100, 1.05000, 1.05300, 1.05200} {
+		if ticks[idx].Bid != bid || math.Abs(ticks[idx].Ask-bid-0.0002) > 1e-9 {
+			t.Errorf("Tick %d: unexpected %v.\n", idx, ticks[idx])
+		}
+	}
+}
+
+func TestHSTUpdate(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	tick := func(m int, bid float64) []*core.TickData {
+		ts := testDay.Add(time.Duration(m) * time.Minute).Unix()
+		return []*core.TickData{{Timestamp: ts * 1000, Bid: bid, VolumeBid: 1}}
+	}
+
+	h := NewHST(1, "EURUSD", dest, nil)
+	for m := 0; m < 3; m++ {
+		h.PackTicks(uint32(testDay.Unix())+uint32(m*60), tick(m, 1.05))
+	}
+	h.Finish()
+
+	fpath := filepath.Join(dest, FileName("EURUSD", 1))
+	f, err := os.OpenFile(fpath, os.O_RDWR, 666)
+	if err != nil {
+		t.Fatalf("Open hst file failed: %v.\n", err)
+	}
+	h = NewUpdate(f, 1, "EURUSD", nil)
+	h.PackTicks(uint32(testDay.Unix())+60, tick(1, 1.01))
+	h.PackTicks(uint32(testDay.Unix())+120, tick(2, 1.02))
+	h.PackTicks(uint32(testDay.Unix())+180, tick(3, 1.03))
+	h.Finish()
+	f.Close()
+
+	r, err := NewReader(fpath)
+	if err != nil {
+		t.Fatalf("Open hst reader failed: %v.\n", err)
+	}
+	defer r.Close()
+
+	bids := []float64{1.05, 1.05, 1.02, 1.03}
+	for idx := 0; ; idx++ {
+		bar, err := r.Read()
+		if err == io.EOF {
+			if idx != len(bids) {
+				t.Errorf("Expect %d bars, got %d.\n", len(bids), idx)
+			}
+			break
+		}
+		if err != nil || idx >= len(bids) {
+			t.Fatalf("Read bar %d failed: %v.\n", idx, err)
+		}
+		if bar.Close != bids[idx] || bar.CTM != uint64(testDay.Unix())+uint64(idx*60) {
+			t.Errorf("Bar %d: unexpected %v.\n", idx, bar)
+		}
+	}
+}
+
+func TestHSTReader400(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	header := NewHeader(60, "EURUSD")
+	header.Version = V400
+	bs, _ := header.ToBytes()
+
+	bars := []BarData400{
+		{CTM: uint32(testDay.Unix()), Open: 1.051, Low: 1.050, High: 1.053, Close: 1.052, Volume: 10},
+		{CTM: uint32(testDay.Unix()) + 3600, Open: 1.052, Low: 1.051, High: 1.054, Close: 1.053, Volume: 20},
+		{CTM: uint32(testDay.Unix()), Open: 1.051, Low: 1.050, High: 1.053, Close: 1.052, Volume: 10},
+	}
+	buf := bytes.NewBuffer(bs)
+	for _, bar := range bars {
+		binary.Write(buf, binary.LittleEndian, &bar)
+	}
+	if buf.Len() != headerBytes+len(bars)*bar400Bytes {
+		t.Fatalf("Unexpected v400 file size %d.\n", buf.Len())
+	}
+
+	fpath := filepath.Join(dest, "EURUSD60.hst")
+	if err := ioutil.WriteFile(fpath, buf.Bytes(), 0666); err != nil {
+		t.Fatalf("Write hst file failed: %v.\n", err)
+	}
+
+	r, err := NewReader(fpath)
+	if err != nil {
+		t.Fatalf("Open hst reader failed: %v.\n", err)
+	}
+	defer r.Close()
+
+	if h := r.Header(); h.Version != V400 || h.SymbolName() != "EURUSD" || h.Period != 60 {
+		t.Errorf("Unexpected header %+v.\n", h)
+	}
+	for idx := 0; idx < 2; idx++ {
+		bar, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read bar %d failed: %v.\n", idx, err)
+		}
+		if bar.CTM != uint64(bars[idx].CTM) || bar.Low != bars[idx].Low || bar.High != bars[idx].High || bar.Volume != uint64(bars[idx].Volume) {
+			t.Errorf("Bar %d: unexpected %v.\n", idx, bar)
+		}
+	}
+	if _, err = r.Read(); err == nil || err == io.EOF {
+		t.Errorf("Expect error of bars out of order, got %v.\n", err)
+	}
+}
+
+func TestHSTWriter400(t *testing.T) {
+	ticks := []*core.TickData{
+		{Timestamp: testDay.Unix()*1000 + 100, Bid: 1.05100, VolumeBid: 2},
+		{Timestamp: testDay.Unix()*1000 + 200, Bid: 1.05300, VolumeBid: 3},
+	}
+
+	var buf bytes.Buffer
+	h := NewWriter(&buf, 1, "EURUSD", &Option{Version: V400})
+	h.PackTicks(uint32(testDay.Unix()), ticks)
+	h.PackTicks(uint32(testDay.Unix())+60, ticks)
+	h.Finish()
+
+	if buf.Len() != headerBytes+2*bar400Bytes {
+		t.Fatalf("Unexpected v400 file size %d.\n", buf.Len())
+	}
+
+	header, err := ReadHeader(&buf)
+	if err != nil || header.Version != V400 {
+		t.Fatalf("Read v400 header failed: %v, %v.\n", header, err)
+	}
+
+	var bar BarData400
+	binary.Read(&buf, binary.LittleEndian, &bar)
+	if bar.CTM != uint32(testDay.Unix()) || bar.Low != 1.05100 || bar.High != 1.05300 || bar.Volume != 5 {
+		t.Errorf("Unexpected v400 bar %+v.\n", bar)
+	}
+}
+
+func TestHSTSpread(t *testing.T) {
+	ticks := []*core.TickData{
+		{Ask: 1.05120, Bid: 1.05100, VolumeAsk: 1.5, VolumeBid: 0.5},
+		{Ask: 1.05150, Bid: 1.05100, VolumeAsk: 0.25, VolumeBid: 0.75},
+		{Ask: 1.05110, Bid: 1.05100, VolumeAsk: 1, VolumeBid: 1},
+	}
+
+	for mode, expect := range map[string]uint32{
+		SpreadMin:   10,
+		SpreadAvg:   27,
+		SpreadMax:   50,
+		SpreadClose: 10,
+		SpreadFixed: 15,
+	} {
+		opt, err := NewOption(0, mode, 15)
+		if err != nil {
+			t.Fatalf("Create option %s failed: %v.\n", mode, err)
+		}
+		if spread := opt.BarSpread(ticks, 0.00001); spread != expect {
+			t.Errorf("Spread %s expect %d, got %d.\n", mode, expect, spread)
+		}
+	}
+
+	if _, err := NewOption(402, "", 0); err == nil {
+		t.Errorf("Expect error of invalid version.\n")
+	}
+	if vol := RealVolume(ticks); vol != 50 {
+		t.Errorf("Real volume expect 50, got %d.\n", vol)
+	}
+}
+
+func TestHSTConvert(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	// M1 bars from 00:58 to 01:07
+	start := uint64(time.Date(2017, 1, 2, 0, 58, 0, 0, time.UTC).Unix())
+	m1 := NewHST(1, "EURUSD", dest, nil)
+	for m := uint64(0); m < 10; m++ {
+		price := 1.05 + float64(m)*0.001
+		m1.PackBar(&BarData{
+			CTM:        start + m*60,
+			Open:       price,
+			High:       price + 0.0005,
+			Low:        price - 0.0005,
+			Close:      price + 0.0001,
+			Volume:     m + 1,
+			Spread:     uint32(10 + m),
+			RealVolume: 10,
+		})
+	}
+	m1.Finish()
+
+	r, err := NewReader(filepath.Join(dest, FileName("EURUSD", 1)))
+	if err != nil {
+		t.Fatalf("Open hst reader failed: %v.\n", err)
+	}
+	defer r.Close()
+
+	opt, _ := NewOption(0, SpreadMax, 0)
+	if err = Convert(r, NewHST(5, "EURUSD", dest, opt), NewHST(60, "EURUSD", dest, nil)); err != nil {
+		t.Fatalf("Convert failed: %v.\n", err)
+	}
+
+	read := func(timeframe uint32) []*BarData {
+		r, err := NewReader(filepath.Join(dest, FileName("EURUSD", timeframe)))
+		if err != nil {
+			t.Fatalf("Open M%d failed: %v.\n", timeframe, err)
+		}
+		defer r.Close()
+
+		bars := make([]*BarData, 0)
+		for {
+			bar, err := r.Read()
+			if err != nil {
+				break
+			}
+			bars = append(bars, bar)
+		}
+		return bars
+	}
+
+	// 00:55 [00:58, 00:59], 01:00 [01:00, 01:04], 01:05 [01:05, 01:07]
+	m5 := read(5)
+	if len(m5) != 3 {
+		t.Fatalf("Expect 3 M5 bars, got %d.\n", len(m5))
+	}
+	if bar := m5[1]; bar.CTM != start+120 || bar.Open != 1.052 || bar.Close != 1.0561 ||
+		bar.High != 1.0565 || bar.Low != 1.0515 || bar.Volume != 3+4+5+6+7 || bar.Spread != 16 || bar.RealVolume != 50 {
+		t.Errorf("Unexpected M5 bar %+v.\n", bar)
+	}
+
+	h1 := read(60)
+	if len(h1) != 2 || h1[0].CTM != start-58*60 || h1[0].Volume != 3 || h1[1].Volume != 52 || h1[1].Spread != 16 {
+		t.Errorf("Unexpected H1 bars %v.\n", h1)
+	}
+
+	// D1 bars from Thursday 2017-01-26 to Monday 2017-02-06
+	day := time.Date(2017, 1, 26, 0, 0, 0, 0, time.UTC)
+	d1 := NewHST(1440, "EURUSD", dest, nil)
+	for d := 0; d < 12; d++ {
+		price := 1.05 + float64(d)*0.001
+		d1.PackBar(&BarData{
+			CTM:    uint64(day.AddDate(0, 0, d).Unix()),
+			Open:   price,
+			High:   price + 0.0005,
+			Low:    price - 0.0005,
+			Close:  price + 0.0001,
+			Volume: uint64(d + 1),
+		})
+	}
+	d1.Finish()
+
+	rd, err := NewReader(filepath.Join(dest, FileName("EURUSD", 1440)))
+	if err != nil {
+		t.Fatalf("Open hst reader failed: %v.\n", err)
+	}
+	defer rd.Close()
+	if err = Convert(rd, NewHST(10080, "EURUSD", dest, nil), NewHST(43200, "EURUSD", dest, nil)); err != nil {
+		t.Fatalf("Convert failed: %v.\n", err)
+	}
+
+	// weeks begin on Sunday: 01-22 [01-26, 01-28], 01-29 [01-29, 02-04], 02-05 [02-05, 02-06]
+	w1 := read(10080)
+	weeks := []struct {
+		day    int
+		volume uint64
+	}{{22, 1 + 2 + 3}, {29, 4 + 5 + 6 + 7 + 8 + 9 + 10}, {36, 11 + 12}}
+	if len(w1) != len(weeks) {
+		t.Fatalf("Expect %d W1 bars, got %d.\n", len(weeks), len(w1))
+	}
+	for idx, w := range weeks {
+		ctm := uint64(time.Date(2017, 1, w.day, 0, 0, 0, 0, time.UTC).Unix())
+		if w1[idx].CTM != ctm || w1[idx].Volume != w.volume {
+			t.Errorf("Unexpected W1 bar %d: %+v.\n", idx, w1[idx])
+		}
+	}
+
+	// calendar months: 01-01 [01-26, 01-31], 02-01 [02-01, 02-06]
+	mn := read(43200)
+	if len(mn) != 2 || mn[0].CTM != uint64(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC).Unix()) || mn[0].Volume != 21 ||
+		mn[1].CTM != uint64(time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC).Unix()) || mn[1].Volume != 57 ||
+		mn[0].Close != 1.0551 || mn[1].Open != 1.056 {
+		t.Errorf("Unexpected MN bars %v.\n", mn)
+	}
+}
@@ -0,0 +1,98 @@
+package hst
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// Spread modes of bar spread in points
+const (
+	SpreadMin   = "min"   // minimum spread of ticks
+	SpreadAvg   = "avg"   // average spread of ticks
+	SpreadMax   = "max"   // maximum spread of ticks
+	SpreadClose = "close" // spread of the last tick
+	SpreadFixed = "fixed" // the fixed spread value
+)
+
+var (
+	// LotSize is the units of one lot, dukascopy volumes are in millions of units
+	LotSize = 100000.0
+)
+
+// Option of hst output
+//
+type Option struct {
+	Version    uint32 // 401 or 400
+	SpreadMode string // min, avg, max, close or fixed
+	Spread     uint32 // fixed spread in points
+	Digits     uint32 // digits of header and spread points, digits of symbol if 0
+}
+
+// NewOption check command line values, version 401 and average spread are used by default
+//
+func NewOption(version uint32, spreadMode string, spread uint32) (*Option, error) {
+	opt := &Option{
+		Version:    V401,
+		SpreadMode: SpreadAvg,
+		Spread:     spread,
+	}
+
+	switch version {
+	case 0:
+		break
+	case V400, V401:
+		opt.Version = version
+	default:
+		return nil, fmt.Errorf("invalid hst version: %d", version)
+	}
+
+	switch spreadMode = strings.ToLower(spreadMode); spreadMode {
+	case "":
+		break
+	case SpreadMin, SpreadAvg, SpreadMax, SpreadClose, SpreadFixed:
+		opt.SpreadMode = spreadMode
+	default:
+		return nil, fmt.Errorf("invalid hst spread mode: %s", spreadMode)
+	}
+	return opt, nil
+}
+
+// BarSpread return the spread of ticks in points by spread mode
+//
+func (o *Option) BarSpread(ticks []*core.TickData, point float64) uint32 {
+	if len(ticks) == 0 || o.SpreadMode == SpreadFixed {
+		return o.Spread
+	}
+
+	var spread float64
+	switch o.SpreadMode {
+	case SpreadMin:
+		spread = math.MaxFloat64
+		for _, tick := range ticks {
+			spread = math.Min(spread, tick.Ask-tick.Bid)
+		}
+	case SpreadMax:
+		for _, tick := range ticks {
+			spread = math.Max(spread, tick.Ask-tick.Bid)
+		}
+	case SpreadClose:
+		tick := ticks[len(ticks)-1]
+		spread = tick.Ask - tick.Bid
+	default:
+		return AvgSpread(ticks, point)
+	}
+	return uint32(math.Max(0, spread/point+0.5))
+}
+
+// RealVolume return the sum of ask and bid volumes of ticks in lots
+//
+func RealVolume(ticks []*core.TickData) uint64 {
+	var total float64
+	for _, tick := range ticks {
+		total += tick.VolumeAsk + tick.VolumeBid
+	}
+	return uint64(total*1e6/LotSize + 0.5)
+}
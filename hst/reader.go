@@ -0,0 +1,172 @@
+package hst
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// Reader read MT4 history file .hst of version 400 or 401,
+// bars of version 400 are converted into BarData.
+//
+type Reader struct {
+	fpath  string
+	header Header
+	f      *os.File
+	r      *bufio.Reader
+	bs     []byte
+	last   uint64 // time of last bar
+}
+
+// NewReader open hst file and parse the header
+//
+func NewReader(fpath string) (*Reader, error) {
+	f, err := os.OpenFile(fpath, os.O_RDONLY, 666)
+	if err != nil {
+		log.Error("Open hst file %s failed: %v.", fpath, err)
+		return nil, err
+	}
+
+	r := &Reader{
+		fpath: fpath,
+		f:     f,
+		r:     bufio.NewReader(f),
+	}
+
+	if err = r.readHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+	r.bs = make([]byte, r.header.BarBytes())
+	return r, nil
+}
+
+func (r *Reader) readHeader() error {
+	h, err := ReadHeader(r.r)
+	if err != nil {
+		return err
+	}
+	r.header = *h
+	return nil
+}
+
+// ReadHeader read and decode hst header from `r`
+//
+func ReadHeader(r io.Reader) (*Header, error) {
+	var h Header
+	bs := make([]byte, headerBytes)
+	if _, err := io.ReadFull(r, bs[:]); err != nil {
+		return nil, fmt.Errorf("read hst header failed: %v", err)
+	}
+	if err := binary.Read(bytes.NewBuffer(bs[:]), binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("decode hst header failed: %v", err)
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// decodeBar decode one bar from bytes of hst `version`
+func decodeBar(version uint32, bs []byte) (*BarData, error) {
+	if version == V400 {
+		old := &BarData400{}
+		if err := binary.Read(bytes.NewBuffer(bs), binary.LittleEndian, old); err != nil {
+			return nil, fmt.Errorf("decode bar data failed: %v", err)
+		}
+		return old.BarData(), nil
+	}
+
+	bar := &BarData{}
+	if err := binary.Read(bytes.NewBuffer(bs), binary.LittleEndian, bar); err != nil {
+		return nil, fmt.Errorf("decode bar data failed: %v", err)
+	}
+	return bar, nil
+}
+
+// Header of the hst file
+//
+func (r *Reader) Header() *Header {
+	return &r.header
+}
+
+// Read next bar, return io.EOF at the end of file.
+// The bars must be ordered by time, otherwise error is returned.
+//
+func (r *Reader) Read() (*BarData, error) {
+	n, err := io.ReadFull(r.r, r.bs[:])
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read bar data failed: %d:%v", n, err)
+	}
+
+	bar, err := decodeBar(r.header.Version, r.bs[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if bar.CTM < r.last {
+		return nil, fmt.Errorf("bar %v is earlier than the previous one", bar)
+	}
+	r.last = bar.CTM
+	return bar, nil
+}
+
+// Close the hst file
+//
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// DumpFile print the header and bars of hst file as csv into `w`, only header if `header` is true
+//
+func DumpFile(fname string, header bool, w io.Writer) {
+	r, err := NewReader(fname)
+	if err != nil {
+		log.Error("Open hst file failed: %v.", err)
+		return
+	}
+	defer r.Close()
+
+	if w == nil {
+		w = os.Stdout
+	}
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	h := r.Header()
+	bw.WriteString(fmt.Sprintf("Header: Version %d, Symbol %s, Period %d, Digits %d, TimeSign %s\n",
+		h.Version, h.SymbolName(), h.Period, h.Digits, time.Unix(int64(h.TimeSign), 0).UTC().Format(time.RFC3339)))
+	if header {
+		// only header
+		return
+	}
+
+	// digits of legacy header may be empty
+	digits := int(h.Digits)
+	if digits == 0 {
+		digits = core.Digits(h.SymbolName())
+	}
+	for {
+		bar, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error("Read hst bar failed: %v.", err)
+			break
+		}
+		bw.WriteString(strings.Join(append(bar.Strings(digits), strconv.FormatUint(uint64(bar.Spread), 10)), ","))
+		bw.WriteString("\n")
+	}
+}
@@ -0,0 +1,92 @@
+package hst
+
+import (
+	"math"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+// barTicks generate ticks from hst bars
+//
+// Each bar is expanded into 4 ticks: open, low, high, close for bullish bar,
+// or open, high, low, close for bearish bar, spread evenly within the bar period.
+//
+type barTicks struct {
+	r      *Reader
+	spread uint32
+	point  float64
+	ticks  []*core.TickData
+}
+
+// NewSource create a tick data source from hst file,
+// `spread` in points is used for bars without spread.
+//
+func NewSource(fpath string, spread uint32) (core.Source, error) {
+	r, err := NewReader(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.NewReaderSource(&barTicks{
+		r:      r,
+		spread: spread,
+		point:  math.Pow10(-int(r.Header().Digits)),
+		ticks:  make([]*core.TickData, 0, 4),
+	}), nil
+}
+
+// Read next tick
+//
+func (b *barTicks) Read() (*core.TickData, error) {
+	if len(b.ticks) == 0 {
+		bar, err := b.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		b.expand(bar)
+	}
+
+	tick := b.ticks[0]
+	b.ticks = b.ticks[1:]
+	return tick, nil
+}
+
+// Close the hst file
+//
+func (b *barTicks) Close() error {
+	return b.r.Close()
+}
+
+func (b *barTicks) expand(bar *BarData) {
+	var (
+		spread = bar.Spread
+		start  = int64(bar.CTM) * 1000
+		delta  = int64(b.r.Header().Period) * 60 * 1000 / 3
+		volume = float64(bar.Volume) / 4
+		prices = []float64{bar.Open, bar.Low, bar.High, bar.Close}
+	)
+
+	if spread == 0 {
+		spread = b.spread
+	}
+	if bar.Close < bar.Open {
+		prices[1], prices[2] = bar.High, bar.Low
+	}
+
+	b.ticks = b.ticks[:0]
+	for idx, price := range prices {
+		ts := start + int64(idx)*delta
+		if idx == len(prices)-1 {
+			// close price at the last second of the bar
+			ts = start + 3*delta - 1000
+		}
+
+		b.ticks = append(b.ticks, &core.TickData{
+			Timestamp: ts,
+			Bid:       price,
+			Ask:       price + float64(spread)*b.point,
+			VolumeAsk: volume,
+			VolumeBid: volume,
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package influx
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
+	"github.com/adyzng/go-duka/misc"
+)
+
+var (
+	log = misc.NewLogger("Influx", 3)
+
+	// escape measurement and tag values of line protocol
+	escaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// Influx write InfluxDB line protocol of ticks or bars into `w`,
+// the measurement is the symbol, bars are tagged by timeframe:
+//
+//	EURUSD ask=1.0511,bid=1.051,ask_volume=0.75,bid_volume=1.5 1483315200123000000
+//	EURUSD,timeframe=M1 open=1.051,high=1.053,low=1.0505,close=1.0505,volume=4i,spread=10i,ticks=4i 1483315200000000000
+//
+// timestamps are nanoseconds, ticks with the same millisecond get an extra nanosecond each
+// so that they are not merged into one point.
+//
+type Influx struct {
+	w           *misc.LineWriter
+	measurement string
+	period      string
+	bars        bool
+	digits      int
+	rowCount    int64
+	chClose     chan struct{}
+	chRows      chan []byte
+}
+
+// New line protocol output of ticks, `w` is not closed by Finish
+//
+func New(w io.Writer, symbol string) *Influx {
+	return newInflux(w, "", false, symbol)
+}
+
+// NewBars line protocol output of `period` bars
+//
+func NewBars(w io.Writer, period, symbol string) *Influx {
+	return newInflux(w, period, true, symbol)
+}
+
+func newInflux(w io.Writer, period string, bars bool, symbol string) *Influx {
+	i := &Influx{
+		w:           misc.NewLineWriter(w, 64<<10),
+		measurement: escaper.Replace(symbol),
+		period:      period,
+		bars:        bars,
+		digits:      core.Digits(symbol),
+		chClose:     make(chan struct{}, 1),
+		chRows:      make(chan []byte, 1024),
+	}
+
+	go i.worker()
+	return i
+}
+
+// Finish flush the remaining lines
+//
+func (i *Influx) Finish() error {
+	close(i.chRows)
+	<-i.chClose
+	return nil
+}
+
+func appendFloat(bs []byte, key string, v float64) []byte {
+	bs = append(bs, key...)
+	bs = append(bs, '=')
+	return strconv.AppendFloat(bs, v, 'f', -1, 64)
+}
+
+func appendInt(bs []byte, key string, v int64) []byte {
+	bs = append(bs, key...)
+	bs = append(bs, '=')
+	bs = strconv.AppendInt(bs, v, 10)
+	return append(bs, 'i')
+}
+
+// PackTicks handle ticks data, the ticks are aggregated into one bar in bars output
+//
+func (i *Influx) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	if i.bars {
+		bar := hst.NewBar(barTimestamp, ticks)
+		bs := make([]byte, 0, 160)
+		bs = append(bs, i.measurement...)
+		bs = append(bs, ",timeframe="...)
+		bs = append(bs, escaper.Replace(i.period)...)
+		bs = appendFloat(append(bs, ' '), "open", bar.Open)
+		bs = appendFloat(append(bs, ','), "high", bar.High)
+		bs = appendFloat(append(bs, ','), "low", bar.Low)
+		bs = appendFloat(append(bs, ','), "close", bar.Close)
+		bs = appendInt(append(bs, ','), "volume", int64(bar.Volume))
+		bs = appendInt(append(bs, ','), "spread", int64(hst.AvgSpread(ticks, math.Pow10(-i.digits))))
+		bs = appendInt(append(bs, ','), "ticks", int64(len(ticks)))
+		bs = strconv.AppendInt(append(bs, ' '), int64(barTimestamp)*int64(time.Second), 10)
+
+		i.chRows <- bs
+		i.rowCount++
+		return nil
+	}
+
+	var lastTs, seq int64
+	for _, tick := range ticks {
+		if tick.Timestamp == lastTs {
+			seq++
+		} else {
+			lastTs, seq = tick.Timestamp, 0
+		}
+
+		bs := make([]byte, 0, 128)
+		bs = append(bs, i.measurement...)
+		bs = appendFloat(append(bs, ' '), "ask", tick.Ask)
+		bs = appendFloat(append(bs, ','), "bid", tick.Bid)
+		bs = appendFloat(append(bs, ','), "ask_volume", tick.VolumeAsk)
+		bs = appendFloat(append(bs, ','), "bid_volume", tick.VolumeBid)
+		bs = strconv.AppendInt(append(bs, ' '), tick.Timestamp*int64(time.Millisecond)+seq, 10)
+
+		i.chRows <- bs
+		i.rowCount++
+	}
+	return nil
+}
+
+// worker goroutine which write lines
+//
+func (i *Influx) worker() error {
+	var err error
+
+	defer func() {
+		for range i.chRows {
+		}
+		close(i.chClose)
+		if i.bars {
+			log.Info("%s Saved Bars: %d.", i.period, i.rowCount)
+		} else {
+			log.Info("Saved Ticks: %d.", i.rowCount)
+		}
+	}()
+
+	for row := range i.chRows {
+		if err = i.w.WriteLine(row); err != nil {
+			log.Error("Write line protocol failed: %v.", err)
+			return err
+		}
+	}
+
+	if err = i.w.Flush(); err != nil {
+		log.Error("Flush line protocol failed: %v.", err)
+	}
+	return err
+}
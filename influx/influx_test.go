@@ -0,0 +1,38 @@
+package influx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+func TestInfluxLines(t *testing.T) {
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := []*core.TickData{
+		{Timestamp: day.Unix()*1000 + 123, Ask: 1.05110, Bid: 1.05100, VolumeAsk: 0.75, VolumeBid: 1.5},
+		{Timestamp: day.Unix()*1000 + 123, Ask: 1.05130, Bid: 1.05110, VolumeAsk: 0.75, VolumeBid: 1.5},
+	}
+
+	var buf bytes.Buffer
+	i := New(&buf, "EURUSD")
+	i.PackTicks(0, ticks)
+	i.Finish()
+
+	expect := "EURUSD ask=1.0511,bid=1.051,ask_volume=0.75,bid_volume=1.5 1483315200123000000\n" +
+		"EURUSD ask=1.0513,bid=1.0511,ask_volume=0.75,bid_volume=1.5 1483315200123000001\n"
+	if buf.String() != expect {
+		t.Errorf("Unexpected ticks:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	b := NewBars(&buf, "M1", "EURUSD")
+	b.PackTicks(uint32(day.Unix()), ticks)
+	b.Finish()
+
+	if line := strings.TrimSpace(buf.String()); line != "EURUSD,timeframe=M1 open=1.051,high=1.0511,low=1.051,close=1.0511,volume=3i,spread=15i,ticks=2i 1483315200000000000" {
+		t.Errorf("Unexpected bar: %s.\n", line)
+	}
+}
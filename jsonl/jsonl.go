@@ -0,0 +1,171 @@
+package jsonl
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
+	"github.com/adyzng/go-duka/misc"
+)
+
+var log = misc.NewLogger("JSONL", 3)
+
+// Tick is one json line of tick
+//
+type Tick struct {
+	Symbol    string  `json:"symbol"`
+	Time      string  `json:"time"`
+	Timestamp int64   `json:"timestamp"`
+	Ask       float64 `json:"ask"`
+	Bid       float64 `json:"bid"`
+	AskVolume float64 `json:"ask_volume"`
+	BidVolume float64 `json:"bid_volume"`
+}
+
+// Bar is one json line of bar, spread is the average in points
+//
+type Bar struct {
+	Symbol    string  `json:"symbol"`
+	Timeframe string  `json:"timeframe"`
+	Time      string  `json:"time"`
+	Timestamp int64   `json:"timestamp"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    uint64  `json:"volume"`
+	Spread    uint32  `json:"spread"`
+	Ticks     int     `json:"ticks"`
+}
+
+// JSONLines write newline-delimited json of ticks or bars into `w`,
+// time is RFC3339 in UTC and timestamp is epoch milliseconds.
+//
+type JSONLines struct {
+	w        *misc.LineWriter
+	symbol   string
+	period   string
+	bars     bool
+	digits   int
+	rowCount int64
+	chClose  chan struct{}
+	chRows   chan interface{}
+}
+
+// New json lines output of ticks, `w` is not closed by Finish
+//
+func New(w io.Writer, symbol string) *JSONLines {
+	return newJSONLines(w, "", false, symbol)
+}
+
+// NewBars json lines output of `period` bars
+//
+func NewBars(w io.Writer, period, symbol string) *JSONLines {
+	return newJSONLines(w, period, true, symbol)
+}
+
+func newJSONLines(w io.Writer, period string, bars bool, symbol string) *JSONLines {
+	j := &JSONLines{
+		w:       misc.NewLineWriter(w, 64<<10),
+		symbol:  symbol,
+		period:  period,
+		bars:    bars,
+		digits:  core.Digits(symbol),
+		chClose: make(chan struct{}, 1),
+		chRows:  make(chan interface{}, 1024),
+	}
+
+	go j.worker()
+	return j
+}
+
+func formatTime(timestamp int64) string {
+	tm := time.Unix(timestamp/1000, (timestamp%1000)*int64(time.Millisecond)).UTC()
+	return tm.Format("2006-01-02T15:04:05.000Z")
+}
+
+// Finish flush the remaining lines
+//
+func (j *JSONLines) Finish() error {
+	close(j.chRows)
+	<-j.chClose
+	return nil
+}
+
+// PackTicks handle ticks data, the ticks are aggregated into one bar in bars output
+//
+func (j *JSONLines) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	if j.bars {
+		bar := hst.NewBar(barTimestamp, ticks)
+		ms := int64(barTimestamp) * 1000
+		j.chRows <- &Bar{
+			Symbol:    j.symbol,
+			Timeframe: j.period,
+			Time:      formatTime(ms),
+			Timestamp: ms,
+			Open:      bar.Open,
+			High:      bar.High,
+			Low:       bar.Low,
+			Close:     bar.Close,
+			Volume:    bar.Volume,
+			Spread:    hst.AvgSpread(ticks, math.Pow10(-j.digits)),
+			Ticks:     len(ticks),
+		}
+		j.rowCount++
+		return nil
+	}
+
+	for _, tick := range ticks {
+		j.chRows <- &Tick{
+			Symbol:    j.symbol,
+			Time:      formatTime(tick.Timestamp),
+			Timestamp: tick.Timestamp,
+			Ask:       tick.Ask,
+			Bid:       tick.Bid,
+			AskVolume: tick.VolumeAsk,
+			BidVolume: tick.VolumeBid,
+		}
+		j.rowCount++
+	}
+	return nil
+}
+
+// worker goroutine which encode and write lines
+//
+func (j *JSONLines) worker() error {
+	var err error
+
+	defer func() {
+		for range j.chRows {
+		}
+		close(j.chClose)
+		if j.bars {
+			log.Info("%s Saved Bars: %d.", j.period, j.rowCount)
+		} else {
+			log.Info("Saved Ticks: %d.", j.rowCount)
+		}
+	}()
+
+	for row := range j.chRows {
+		var bs []byte
+		if bs, err = json.Marshal(row); err == nil {
+			err = j.w.WriteLine(bs)
+		}
+		if err != nil {
+			log.Error("Write json line failed: %v.", err)
+			return err
+		}
+	}
+
+	if err = j.w.Flush(); err != nil {
+		log.Error("Flush json lines failed: %v.", err)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package jsonl
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+func TestJSONLines(t *testing.T) {
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := []*core.TickData{
+		{Timestamp: day.Unix()*1000 + 123, Ask: 1.05110, Bid: 1.05100, VolumeAsk: 0.75, VolumeBid: 1.5},
+		{Timestamp: day.Unix()*1000 + 456, Ask: 1.05130, Bid: 1.05110, VolumeAsk: 0.75, VolumeBid: 1.5},
+	}
+
+	var buf bytes.Buffer
+	j := New(&buf, "EURUSD")
+	j.PackTicks(0, ticks)
+	j.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expect 2 lines, got %d.\n", len(lines))
+	}
+	var tick Tick
+	if err := json.Unmarshal([]byte(lines[1]), &tick); err != nil {
+		t.Fatalf("Decode %s failed: %v.\n", lines[1], err)
+	}
+	if tick.Symbol != "EURUSD" || tick.Time != "2017-01-02T00:00:00.456Z" || tick.Ask != 1.05130 {
+		t.Errorf("Unexpected tick %+v.\n", tick)
+	}
+
+	buf.Reset()
+	b := NewBars(&buf, "M1", "EURUSD")
+	b.PackTicks(uint32(day.Unix()), ticks)
+	b.Finish()
+
+	var bar Bar
+	if err := json.Unmarshal(buf.Bytes(), &bar); err != nil {
+		t.Fatalf("Decode %s failed: %v.\n", buf.String(), err)
+	}
+	if bar.Timeframe != "M1" || bar.Open != 1.05100 || bar.Close != 1.05110 || bar.Spread != 15 || bar.Ticks != 2 {
+		t.Errorf("Unexpected bar %+v.\n", bar)
+	}
+}
+
+func TestJSONLinesMonth(t *testing.T) {
+	// the last second of January and the first of February
+	last := time.Date(2017, 1, 31, 23, 59, 59, 0, time.UTC).Unix() * 1000
+	ticks := []*core.TickData{
+		{Timestamp: last, Ask: 1.07110, Bid: 1.07100, VolumeBid: 1},
+		{Timestamp: last + 1000, Ask: 1.07210, Bid: 1.07200, VolumeBid: 1},
+	}
+
+	var buf bytes.Buffer
+	tf := core.NewTimeframe("MN1", "EURUSD", NewBars(&buf, "MN1", "EURUSD"))
+	tf.PackTicks(0, ticks)
+	tf.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expect 2 bars, got %d.\n", len(lines))
+	}
+	for idx, expect := range []string{"2017-01-01T00:00:00.000Z", "2017-02-01T00:00:00.000Z"} {
+		var bar Bar
+		if err := json.Unmarshal([]byte(lines[idx]), &bar); err != nil {
+			t.Fatalf("Decode %s failed: %v.\n", lines[idx], err)
+		}
+		if bar.Time != expect || bar.Open != ticks[idx].Bid || bar.Ticks != 1 {
+			t.Errorf("Expect bar at %s, got %+v.\n", expect, bar)
+		}
+	}
+}
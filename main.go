@@ -3,10 +3,14 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/adyzng/go-duka/fxt4"
+	"github.com/adyzng/go-duka/hst"
 	"github.com/go-clog/clog"
 )
 
@@ -38,19 +42,66 @@ func init() {
 	*/
 }
 
+// listFlag is a repeatable flag, the values are kept in order
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 type argsList struct {
-	Verbose bool
-	Header  bool
-	Local   bool
-	Spread  uint
-	Model   uint
-	Dump    string
-	Symbol  string
-	Output  string
-	Format  string
-	Period  string
-	Start   string
-	End     string
+	Verbose     bool
+	Header      bool
+	Local       bool
+	Bars        bool
+	Update      bool
+	PqExtra     bool
+	PqRowGroup  int
+	Spread      uint
+	Model       uint
+	HstVersion  uint
+	FxtProlog   uint
+	Markup      float64
+	MarkupPct   float64
+	Commission  float64
+	MarkupSide  string
+	MarkupTime  string
+	Dump        string
+	Convert     string
+	Verify      string
+	Source      string
+	Input       string
+	InColumns   string
+	InDelim     string
+	InTimeFmt   string
+	CsvColumns  string
+	CsvDelim    string
+	CsvTimeFmt  string
+	CsvMode     string
+	CsvSplit    string
+	CsvCompress string
+	HstSpread   string
+	FxtSpread   string
+	FxtSpec     string
+	FxtSet      listFlag
+	FxtSplit    string
+	TestExpert  string
+	TestInputs  listFlag
+	SymbolsRaw  string
+	PqUnit      string
+	PqCompress  string
+	SQLiteDB    string
+	Symbol      string
+	Output      string
+	Format      string
+	Period      string
+	Start       string
+	End         string
 }
 
 func main() {
@@ -59,7 +110,61 @@ func main() {
 	end := time.Now().Add(24 * time.Hour).Format("2006-01-02")
 	flag.StringVar(&args.Dump,
 		"dump", "",
-		"dump given file format")
+		"dump given fxt or hst file")
+	flag.StringVar(&args.Verify,
+		"verify", "",
+		"verify given fxt file and report the estimated modelling quality")
+	flag.StringVar(&args.Convert,
+		"convert", "",
+		"convert given hst file into higher timeframes like MT4 period_converter")
+	flag.StringVar(&args.Source,
+		"source", "",
+		"tick data source: dukascopy, bi5, csv, hst (guess from input by default)")
+	flag.StringVar(&args.Input,
+		"input", "",
+		"input file of csv/hst source, or bi5 cache folder")
+	flag.StringVar(&args.InColumns,
+		"in-columns", "",
+		"input csv columns in order, like: time,ask,bid,ask_volume,bid_volume ('-' to skip)")
+	flag.StringVar(&args.InDelim,
+		"in-delim", ",",
+		"input csv field delimiter")
+	flag.StringVar(&args.InTimeFmt,
+		"in-timefmt", "2006-01-02 15:04:05.000",
+		"input csv time format, go time layout or unix, unix_ms, rfc3339, mt4")
+	flag.StringVar(&args.CsvMode,
+		"csv-mode", "ticks",
+		"csv output mode: ticks, bars (OHLCV per timeframe), mt4 (MT4 History Center import)")
+	flag.StringVar(&args.CsvSplit,
+		"csv-split", "",
+		"split csv output by day, week, month or size like 100MB, 1GB")
+	flag.StringVar(&args.CsvCompress,
+		"csv-compress", "",
+		"compress csv output with gzip or zstd")
+	flag.StringVar(&args.CsvColumns,
+		"csv-columns", "",
+		"output csv columns in order, time,date,ask,bid,ask_volume,bid_volume,mid,spread")
+	flag.StringVar(&args.CsvDelim,
+		"csv-delim", ",",
+		"output csv field delimiter")
+	flag.StringVar(&args.CsvTimeFmt,
+		"csv-timefmt", "2006-01-02 15:04:05.000",
+		"output csv time format, go time layout or unix, unix_ms, rfc3339, mt4")
+	flag.StringVar(&args.PqUnit,
+		"parquet-unit", "ms",
+		"parquet timestamp unit: ms, ns")
+	flag.StringVar(&args.PqCompress,
+		"parquet-compress", "snappy",
+		"parquet compression: snappy, gzip, zstd, none")
+	flag.IntVar(&args.PqRowGroup,
+		"parquet-rowgroup", 128,
+		"parquet row group size in MB")
+	flag.BoolVar(&args.PqExtra,
+		"parquet-extra", false,
+		"add mid and spread columns to parquet ticks")
+	flag.StringVar(&args.SQLiteDB,
+		"sqlite-db", "duka.db",
+		"sqlite database file, relative to output directory")
 	flag.StringVar(&args.Period,
 		"timeframe", "M1",
 		"timeframe values: M1, M5, M15, M30, H1, H4, D1, W1, MN")
@@ -74,16 +179,67 @@ func main() {
 		"end date format YYYY-MM-DD")
 	flag.StringVar(&args.Output,
 		"output", ".",
-		"destination directory to save the output file")
+		"destination directory to save the output file, '-' to write to stdout")
 	flag.UintVar(&args.Spread,
 		"spread", 20,
 		"spread value in points")
+	flag.Float64Var(&args.Markup,
+		"markup", 0,
+		"widen spread by fixed points")
+	flag.Float64Var(&args.MarkupPct,
+		"markup-pct", 0,
+		"widen spread by percentage of the raw spread")
+	flag.Float64Var(&args.Commission,
+		"commission", 0,
+		"round-turn commission in points, added to spread")
+	flag.StringVar(&args.MarkupSide,
+		"markup-side", "both",
+		"side to widen spread: both, ask, bid")
+	flag.StringVar(&args.MarkupTime,
+		"markup-schedule", "",
+		"time of day markup in points (UTC), like: 21:00-22:00=15,22:00-23:00=5")
 	flag.UintVar(&args.Model,
 		"model", 0,
-		"one of the model values: 0, 1, 2")
+		"fxt model: 0 every tick, 2 open prices, 1 control points is not supported")
+	flag.UintVar(&args.HstVersion,
+		"hst-version", 401,
+		"hst file version: 401, or 400 for legacy MT4 builds before 600")
+	flag.StringVar(&args.HstSpread,
+		"hst-spread", "avg",
+		"hst bar spread: min, avg, max, close of ticks, or fixed to use -spread value")
+	flag.StringVar(&args.FxtSpread,
+		"fxt-spread", "fixed",
+		"fxt spread: fixed to use -spread value, or variable to save the spread of each tick in volume field")
+	flag.UintVar(&args.FxtProlog,
+		"fxt-prolog", 0,
+		"days of prolog bars before -start for fxt, which give history to indicators at the start of test")
+	flag.StringVar(&args.FxtSplit,
+		"fxt-split", "",
+		"split fxt output by month, quarter, year or size like 2GB, the files are named like EURUSD15_0-2017-01.fxt")
+	flag.StringVar(&args.TestExpert,
+		"tester-expert", "",
+		"expert name to save MT4 tester ini besides each fxt file, like EURUSD15_0.ini for terminal.exe /config:")
+	flag.Var(&args.TestInputs,
+		"tester-inputs",
+		"expert input saved into the set file of tester ini, repeat for each input, like: -tester-inputs Lots=0.1 -tester-inputs StopLoss=50")
+	flag.StringVar(&args.FxtSpec,
+		"fxt-spec", "",
+		"symbol specification file of fxt header, json, yaml or ini")
+	flag.Var(&args.FxtSet,
+		"fxt-set",
+		"override one value of fxt header specification, repeat for each value, like: -fxt-set leverage=500 -fxt-set swap_long=-2.5")
+	flag.StringVar(&args.SymbolsRaw,
+		"symbols-raw", "",
+		"MT4 history/<server>/symbols.raw to load the symbol specification of fxt header and hst digits")
 	flag.StringVar(&args.Format,
 		"format", "",
-		"output file format, supported csv/hst/fxt")
+		"output file format, supported csv/hst/fxt/parquet/arrow/sqlite/jsonl/influx")
+	flag.BoolVar(&args.Bars,
+		"bars", false,
+		"save bars of each timeframe instead of ticks, for parquet/arrow/sqlite/jsonl/influx format")
+	flag.BoolVar(&args.Update,
+		"update", false,
+		"merge into the existing hst files instead of overwriting them")
 	flag.BoolVar(&args.Header,
 		"header", false,
 		"save csv with header")
@@ -95,43 +251,105 @@ func main() {
 		"verbose output trace log")
 	flag.Parse()
 
-	if args.Verbose {
-		clog.New(clog.CONSOLE, clog.ConsoleConfig{
-			Level:      clog.TRACE,
-			BufferSize: 100,
-		})
-	} else {
+	// logs are dropped if stdout is used by the output data
+	if args.Output != "-" {
+		level := clog.INFO
+		if args.Verbose {
+			level = clog.TRACE
+		}
 		clog.New(clog.CONSOLE, clog.ConsoleConfig{
-			Level:      clog.INFO,
+			Level:      level,
 			BufferSize: 100,
 		})
 	}
 
 	if args.Dump != "" {
-		if filepath.Ext(args.Dump) == ".fxt" {
+		switch filepath.Ext(args.Dump) {
+		case ".fxt":
 			fxt4.DumpFile(args.Dump, args.Header, nil)
-		} else {
+		case ".hst":
+			hst.DumpFile(args.Dump, args.Header, nil)
+		default:
 			fmt.Println("invalid file ext", filepath.Ext(args.Dump))
 		}
 		return
 	}
 
+	if args.Verify != "" {
+		report, err := fxt4.Verify(args.Verify)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(report)
+		if !report.OK() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args.Convert != "" {
+		defer clog.Shutdown()
+		if err := ConvertHst(args); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
 	opt, err := ParseOption(args)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Printf("    Output: %s\n", opt.Folder)
-	fmt.Printf("    Symbol: %s\n", opt.Symbol)
-	fmt.Printf("    Spread: %d\n", opt.Spread)
-	fmt.Printf("      Mode: %d\n", opt.Mode)
-	fmt.Printf(" Timeframe: %s\n", opt.Periods)
-	fmt.Printf("    Format: %s\n", opt.Format)
-	fmt.Printf(" CsvHeader: %t\n", opt.CsvHeader)
-	fmt.Printf(" LocalData: %t\n", opt.Local)
-	fmt.Printf(" StartDate: %s\n", opt.Start.Format("2006-01-02:15H"))
-	fmt.Printf("   EndDate: %s\n", opt.End.Format("2006-01-02:15H"))
+	// keep stdout clean for the output data
+	info := io.Writer(os.Stdout)
+	if opt.Stdout {
+		info = os.Stderr
+	}
+	fmt.Fprintf(info, "    Output: %s\n", opt.Folder)
+	fmt.Fprintf(info, "    Symbol: %s\n", opt.Symbol)
+	fmt.Fprintf(info, "    Spread: %d\n", opt.Spread)
+	fmt.Fprintf(info, "      Mode: %d\n", opt.Mode)
+	if opt.Markup != nil {
+		fmt.Fprintf(info, "    Markup: %+v\n", *opt.Markup)
+	}
+	fmt.Fprintf(info, " Timeframe: %s\n", opt.Periods)
+	fmt.Fprintf(info, "    Format: %s\n", opt.Format)
+	fmt.Fprintf(info, " CsvHeader: %t\n", opt.CsvHeader)
+	if opt.Format == "csv" {
+		fmt.Fprintf(info, "   CsvMode: %s\n", opt.CsvMode)
+	}
+	if opt.Format == "parquet" || opt.Format == "arrow" || opt.Format == "sqlite" {
+		fmt.Fprintf(info, "      Bars: %t\n", opt.Bars)
+	}
+	if opt.Format == "fxt" {
+		fmt.Fprintf(info, "       Fxt: Model %d, Spread %d, SpreadMode %s, Split %s/%d\n",
+			opt.FxtOpt.Model, opt.FxtOpt.Spread, opt.FxtOpt.SpreadMode, opt.FxtOpt.Split, opt.FxtOpt.SplitSize)
+		if opt.FxtOpt.Tester != nil {
+			fmt.Fprintf(info, "    Expert: %s, Inputs: %v\n", opt.FxtOpt.Tester.Expert, opt.FxtOpt.Tester.Inputs)
+		}
+		fmt.Fprintf(info, "    Tester: %s - %s\n",
+			time.Unix(int64(opt.FxtOpt.From), 0).UTC().Format("2006-01-02"), time.Unix(int64(opt.FxtOpt.To), 0).UTC().Format("2006-01-02"))
+		fmt.Fprintf(info, "   FxtSpec: %+v\n", *opt.FxtOpt.Spec)
+	}
+	if opt.Format == "hst" {
+		fmt.Fprintf(info, "       Hst: %+v\n", *opt.HstOpt)
+		fmt.Fprintf(info, "    Update: %t\n", opt.Update)
+	}
+	if opt.Format == "sqlite" {
+		fmt.Fprintf(info, "  SQLiteDB: %s\n", opt.SQLiteDB)
+	}
+	if opt.Format == "parquet" {
+		fmt.Fprintf(info, "   Parquet: %+v\n", *opt.ParquetOpt)
+	}
+	fmt.Fprintf(info, " LocalData: %t\n", opt.Local)
+	fmt.Fprintf(info, "    Source: %s\n", opt.Source)
+	if opt.Input != "" {
+		fmt.Fprintf(info, "     Input: %s\n", opt.Input)
+	}
+	fmt.Fprintf(info, " StartDate: %s\n", opt.Start.Format("2006-01-02:15H"))
+	fmt.Fprintf(info, "   EndDate: %s\n", opt.End.Format("2006-01-02:15H"))
 
 	defer clog.Shutdown()
 	app := NewApp(opt)
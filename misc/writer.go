@@ -0,0 +1,63 @@
+package misc
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// SyncWriter serialize writes from many goroutines, used to share stdout between outputs
+//
+type SyncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewSyncWriter wrap `w` with a mutex
+//
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{w: w}
+}
+
+func (s *SyncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// LineWriter buffer whole lines and write them to `w` in batches,
+// so lines from different outputs sharing one SyncWriter never interleave.
+//
+type LineWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	max int
+}
+
+// NewLineWriter create LineWriter which flush every `size` bytes
+//
+func NewLineWriter(w io.Writer, size int) *LineWriter {
+	return &LineWriter{w: w, max: size}
+}
+
+// WriteLine append one line, `line` should not contain the line break
+//
+func (l *LineWriter) WriteLine(line []byte) error {
+	l.buf.Write(line)
+	l.buf.WriteByte('\n')
+	if l.buf.Len() < l.max {
+		return nil
+	}
+	return l.Flush()
+}
+
+// Flush the buffered lines
+//
+func (l *LineWriter) Flush() error {
+	if l.buf.Len() == 0 {
+		return nil
+	}
+	_, err := l.w.Write(l.buf.Bytes())
+	l.buf.Reset()
+	return err
+}
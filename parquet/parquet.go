@@ -0,0 +1,360 @@
+package parquet
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
+	"github.com/adyzng/go-duka/misc"
+	pq "github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Timestamp units of parquet output
+const (
+	UnitMillis = "ms"
+	UnitNanos  = "ns"
+)
+
+// Compression codecs of parquet output
+const (
+	CompressSnappy = "snappy"
+	CompressGzip   = "gzip"
+	CompressZstd   = "zstd"
+	CompressNone   = "none"
+)
+
+var (
+	ext = "parquet"
+	log = misc.NewLogger("Parquet", 3)
+
+	codecs = map[string]pq.CompressionCodec{
+		CompressSnappy: pq.CompressionCodec_SNAPPY,
+		CompressGzip:   pq.CompressionCodec_GZIP,
+		CompressZstd:   pq.CompressionCodec_ZSTD,
+		CompressNone:   pq.CompressionCodec_UNCOMPRESSED,
+	}
+)
+
+// Option of parquet output
+//
+type Option struct {
+	Unit     string // timestamp unit, ms or ns
+	RowGroup int64  // row group size in bytes
+	Compress string // snappy, gzip, zstd or none
+	Extra    bool   // add mid and spread columns to ticks
+}
+
+// NewOption parse command line values, `rowGroup` is in MB
+//
+func NewOption(unit, compress string, rowGroup int, extra bool) (*Option, error) {
+	opt := &Option{
+		Unit:     UnitMillis,
+		RowGroup: 128 << 20,
+		Compress: CompressSnappy,
+		Extra:    extra,
+	}
+
+	switch unit = strings.ToLower(unit); unit {
+	case "":
+		break
+	case UnitMillis, UnitNanos:
+		opt.Unit = unit
+	default:
+		return nil, fmt.Errorf("invalid parquet timestamp unit: %s", unit)
+	}
+
+	if compress = strings.ToLower(compress); compress != "" {
+		if _, ok := codecs[compress]; !ok {
+			return nil, fmt.Errorf("invalid parquet compression: %s", compress)
+		}
+		opt.Compress = compress
+	}
+
+	if rowGroup < 0 {
+		return nil, fmt.Errorf("invalid parquet row group size: %d", rowGroup)
+	}
+	if rowGroup > 0 {
+		opt.RowGroup = int64(rowGroup) << 20
+	}
+	return opt, nil
+}
+
+// pqRow is one parquet row with timestamp in milliseconds for partition
+type pqRow struct {
+	timestamp int64
+	values    []interface{}
+}
+
+// Parquet save ticks or bars into hive-style partitioned parquet files:
+//
+//	DEST/ticks/symbol=EURUSD/year=2017/month=01/part-20170102.parquet
+//	DEST/bars/timeframe=M15/symbol=EURUSD/year=2017/month=01/part-20170102.parquet
+//
+// one file is created per month, named by the date of its first row.
+//
+type Parquet struct {
+	dst      core.Destination
+	single   bool // one stream without partition
+	symbol   string
+	period   string
+	bars     bool
+	digits   int
+	opt      *Option
+	rowCount int64
+	chClose  chan struct{}
+	chRows   chan *pqRow
+}
+
+// New parquet output of ticks, default option is used if `opt` is nil
+//
+func New(symbol, dest string, opt *Option) *Parquet {
+	return newParquet(core.NewFolder(dest), false, "", false, symbol, opt)
+}
+
+// NewBars parquet output of `period` bars
+//
+func NewBars(period, symbol, dest string, opt *Option) *Parquet {
+	return newParquet(core.NewFolder(dest), false, period, true, symbol, opt)
+}
+
+// NewWriter parquet output of ticks into `w` as one file without partition, `w` is not closed by Finish
+//
+func NewWriter(w io.Writer, symbol string, opt *Option) *Parquet {
+	return newParquet(core.NewWriterDest(w), true, "", false, symbol, opt)
+}
+
+// NewBarsWriter parquet output of `period` bars into `w` as one file without partition
+//
+func NewBarsWriter(w io.Writer, period, symbol string, opt *Option) *Parquet {
+	return newParquet(core.NewWriterDest(w), true, period, true, symbol, opt)
+}
+
+func newParquet(dst core.Destination, single bool, period string, bars bool, symbol string, opt *Option) *Parquet {
+	if opt == nil {
+		opt, _ = NewOption("", "", 0, false)
+	}
+
+	p := &Parquet{
+		dst:     dst,
+		single:  single,
+		symbol:  symbol,
+		period:  period,
+		bars:    bars,
+		digits:  core.Digits(symbol),
+		opt:     opt,
+		chClose: make(chan struct{}, 1),
+		chRows:  make(chan *pqRow, 1024),
+	}
+
+	go p.worker()
+	return p
+}
+
+// metadata of parquet columns
+func (p *Parquet) metadata() []string {
+	ts := "name=timestamp, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=MILLIS"
+	if p.opt.Unit == UnitNanos {
+		ts = "name=timestamp, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=NANOS"
+	}
+
+	if p.bars {
+		return []string{
+			ts,
+			"name=open, type=DOUBLE",
+			"name=high, type=DOUBLE",
+			"name=low, type=DOUBLE",
+			"name=close, type=DOUBLE",
+			"name=volume, type=INT64",
+			"name=spread, type=INT32",
+			"name=ticks, type=INT64",
+		}
+	}
+
+	md := []string{
+		ts,
+		"name=ask, type=DOUBLE",
+		"name=bid, type=DOUBLE",
+		"name=ask_volume, type=DOUBLE",
+		"name=bid_volume, type=DOUBLE",
+	}
+	if p.opt.Extra {
+		md = append(md,
+			"name=mid, type=DOUBLE",
+			"name=spread, type=DOUBLE",
+		)
+	}
+	return md
+}
+
+// timestamp convert milliseconds into column value
+func (p *Parquet) timestamp(ms int64) int64 {
+	if p.opt.Unit == UnitNanos {
+		return ms * int64(time.Millisecond)
+	}
+	return ms
+}
+
+// Finish complete parquet file writing
+//
+func (p *Parquet) Finish() error {
+	close(p.chRows)
+	<-p.chClose
+	return nil
+}
+
+// PackTicks handle ticks data, the ticks are aggregated into one bar in bars output
+//
+func (p *Parquet) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	point := math.Pow10(-p.digits)
+	if p.bars {
+		bar := hst.NewBar(barTimestamp, ticks)
+		bar.Spread = hst.AvgSpread(ticks, point)
+
+		ms := int64(barTimestamp) * 1000
+		p.chRows <- &pqRow{ms, []interface{}{
+			p.timestamp(ms),
+			bar.Open,
+			bar.High,
+			bar.Low,
+			bar.Close,
+			int64(bar.Volume),
+			int32(bar.Spread),
+			int64(len(ticks)),
+		}}
+		p.rowCount++
+		return nil
+	}
+
+	for _, tick := range ticks {
+		values := []interface{}{
+			p.timestamp(tick.Timestamp),
+			tick.Ask,
+			tick.Bid,
+			tick.VolumeAsk,
+			tick.VolumeBid,
+		}
+		if p.opt.Extra {
+			values = append(values, (tick.Ask+tick.Bid)/2, (tick.Ask-tick.Bid)/point)
+		}
+		p.chRows <- &pqRow{tick.Timestamp, values}
+		p.rowCount++
+	}
+	return nil
+}
+
+// partDir return the hive-style partition folder of timestamp in milliseconds
+func (p *Parquet) partDir(timestamp int64) string {
+	if p.single {
+		return ""
+	}
+
+	tm := time.Unix(timestamp/1000, 0).UTC()
+	parts := []string{"ticks"}
+	if p.bars {
+		parts = []string{"bars", "timeframe=" + p.period}
+	}
+	return path.Join(append(parts,
+		"symbol="+p.symbol,
+		fmt.Sprintf("year=%04d", tm.Year()),
+		fmt.Sprintf("month=%02d", tm.Month()),
+	)...)
+}
+
+// partFile is one parquet file of a partition
+type partFile struct {
+	fpath string
+	dir   string
+	f     io.WriteCloser
+	pw    *writer.CSVWriter
+}
+
+func (p *Parquet) openPart(dir string, timestamp int64) (*partFile, error) {
+	name := fmt.Sprintf("part-%s.%s", time.Unix(timestamp/1000, 0).UTC().Format("20060102"), ext)
+	fpath := path.Join(dir, name)
+	f, err := p.dst.Create(fpath)
+	if err != nil {
+		log.Error("Failed to create file %s, error %v.", fpath, err)
+		return nil, err
+	}
+
+	pw, err := writer.NewCSVWriterFromWriter(p.metadata(), f, 1)
+	if err != nil {
+		f.Close()
+		log.Error("Create parquet writer %s failed: %v.", fpath, err)
+		return nil, err
+	}
+	pw.RowGroupSize = p.opt.RowGroup
+	pw.CompressionType = codecs[p.opt.Compress]
+
+	return &partFile{
+		fpath: fpath,
+		dir:   dir,
+		f:     f,
+		pw:    pw,
+	}, nil
+}
+
+// Close write parquet footer and close the file
+func (pf *partFile) Close() error {
+	err := pf.pw.WriteStop()
+	if e := pf.f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		log.Error("Close parquet %s failed: %v.", pf.fpath, err)
+	} else {
+		log.Trace("Saved file %s.", pf.fpath)
+	}
+	return err
+}
+
+// worker goroutine which flush data to disk
+//
+func (p *Parquet) worker() error {
+	var (
+		err  error
+		part *partFile
+	)
+
+	defer func() {
+		if part != nil {
+			part.Close()
+		}
+		for range p.chRows {
+		}
+		close(p.chClose)
+		if p.bars {
+			log.Info("%s Saved Bars: %d.", p.period, p.rowCount)
+		} else {
+			log.Info("Saved Ticks: %d.", p.rowCount)
+		}
+	}()
+
+	for row := range p.chRows {
+		if dir := p.partDir(row.timestamp); part == nil || part.dir != dir {
+			if part != nil {
+				part.Close()
+			}
+			if part, err = p.openPart(dir, row.timestamp); err != nil {
+				break
+			}
+		}
+
+		if err = part.pw.Write(row.values); err != nil {
+			log.Error("Write parquet %s failed: %v.", part.fpath, err)
+			break
+		}
+	}
+
+	return err
+}
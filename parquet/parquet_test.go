@@ -0,0 +1,150 @@
+package parquet
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// pqFile is the content of one parquet file read back by column
+type pqFile struct {
+	names   []string
+	unit    string // unit of timestamp column
+	rows    int64
+	columns [][]interface{}
+}
+
+func readParquet(t *testing.T, fpath string) *pqFile {
+	f, err := local.NewLocalFileReader(fpath)
+	if err != nil {
+		t.Fatalf("Open %s failed: %v.\n", fpath, err)
+	}
+	defer f.Close()
+
+	pr, err := reader.NewParquetColumnReader(f, 1)
+	if err != nil {
+		t.Fatalf("Read %s failed: %v.\n", fpath, err)
+	}
+	defer pr.ReadStop()
+
+	pf := &pqFile{rows: pr.GetNumRows()}
+	if ts := pr.Footer.Schema[1].GetLogicalType().GetTIMESTAMP(); ts != nil {
+		switch unit := ts.GetUnit(); {
+		case unit.IsSetMILLIS():
+			pf.unit = UnitMillis
+		case unit.IsSetNANOS():
+			pf.unit = UnitNanos
+		}
+	}
+	for idx, info := range pr.SchemaHandler.Infos[1:] {
+		values, _, _, err := pr.ReadColumnByIndex(int64(idx), pf.rows)
+		if err != nil {
+			t.Fatalf("Read column %s of %s failed: %v.\n", info.ExName, fpath, err)
+		}
+		pf.names = append(pf.names, info.ExName)
+		pf.columns = append(pf.columns, values)
+	}
+	return pf
+}
+
+// tempDir create a temp folder for the output files, it's removed by the returned func
+func tempDir(t *testing.T) (string, func()) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	return dest, func() { os.RemoveAll(dest) }
+}
+
+// stepTicks create n ticks from start, one of each step, the prices rise by inc
+func stepTicks(start time.Time, step time.Duration, n int, inc float64) []*core.TickData {
+	ticks := make([]*core.TickData, 0, n)
+	for idx := 0; idx < n; idx++ {
+		ticks = append(ticks, &core.TickData{
+			Timestamp: start.Add(time.Duration(idx)*step).Unix() * 1000,
+			Ask:       1.05110 + float64(idx)*inc,
+			Bid:       1.05100 + float64(idx)*inc,
+			VolumeAsk: 1.5,
+			VolumeBid: 2.5,
+		})
+	}
+	return ticks
+}
+
+func TestParquetPartition(t *testing.T) {
+	dest, clean := tempDir(t)
+	defer clean()
+
+	day := time.Date(2017, 1, 31, 0, 0, 0, 0, time.UTC)
+	ticks := stepTicks(day, time.Hour, 48, 0.00001)
+
+	opt, err := NewOption("ns", "zstd", 64, true)
+	if err != nil {
+		t.Fatalf("Invalid option: %v.\n", err)
+	}
+	p := New("EURUSD", dest, opt)
+	p.PackTicks(0, ticks)
+	p.Finish()
+
+	b := NewBars("H1", "EURUSD", dest, nil)
+	b.PackTicks(uint32(day.Unix()), ticks)
+	b.Finish()
+
+	tickNames := []string{"timestamp", "ask", "bid", "ask_volume", "bid_volume", "mid", "spread"}
+	tests := []struct {
+		fpath string
+		names []string
+		unit  string
+		rows  int64
+		first time.Time
+	}{
+		{"ticks/symbol=EURUSD/year=2017/month=01/part-20170131.parquet", tickNames, UnitNanos, 24, day},
+		{"ticks/symbol=EURUSD/year=2017/month=02/part-20170201.parquet", tickNames, UnitNanos, 24, day.AddDate(0, 0, 1)},
+	}
+	for _, tt := range tests {
+		pf := readParquet(t, filepath.Join(dest, filepath.FromSlash(tt.fpath)))
+		if !reflect.DeepEqual(pf.names, tt.names) || pf.unit != tt.unit || pf.rows != tt.rows {
+			t.Fatalf("%s: columns %v, unit %s, rows %d.\n", tt.fpath, pf.names, pf.unit, pf.rows)
+		}
+		if ts := pf.columns[0][0].(int64); ts != tt.first.UnixNano() {
+			t.Errorf("%s: first timestamp %d, expect %d.\n", tt.fpath, ts, tt.first.UnixNano())
+		}
+
+		h := int(tt.first.Sub(day) / time.Hour)
+		ask, bid := pf.columns[1][1].(float64), pf.columns[2][1].(float64)
+		mid, spread := pf.columns[5][1].(float64), pf.columns[6][1].(float64)
+		if ask != ticks[h+1].Ask || bid != ticks[h+1].Bid {
+			t.Errorf("%s: ask/bid %v/%v, expect %v/%v.\n", tt.fpath, ask, bid, ticks[h+1].Ask, ticks[h+1].Bid)
+		}
+		if math.Abs(mid-(ask+bid)/2) > 1e-9 || math.Abs(spread-10) > 1e-6 {
+			t.Errorf("%s: mid %v, spread %v.\n", tt.fpath, mid, spread)
+		}
+	}
+
+	pf := readParquet(t, filepath.Join(dest, "bars", "timeframe=H1", "symbol=EURUSD", "year=2017", "month=01", "part-20170131.parquet"))
+	barNames := []string{"timestamp", "open", "high", "low", "close", "volume", "spread", "ticks"}
+	if !reflect.DeepEqual(pf.names, barNames) || pf.unit != UnitMillis || pf.rows != 1 {
+		t.Fatalf("bars: columns %v, unit %s, rows %d.\n", pf.names, pf.unit, pf.rows)
+	}
+	bar := []interface{}{day.Unix() * 1000, ticks[0].Bid, ticks[47].Bid, ticks[0].Bid, ticks[47].Bid, int64(120), int32(10), int64(48)}
+	for idx, value := range bar {
+		if pf.columns[idx][0] != value {
+			t.Errorf("bars: %s %v, expect %v.\n", pf.names[idx], pf.columns[idx][0], value)
+		}
+	}
+
+	if _, err := NewOption("us", "", 0, false); err == nil {
+		t.Errorf("Expect invalid unit error.\n")
+	}
+	if _, err := NewOption("", "lzo", 0, false); err == nil {
+		t.Errorf("Expect invalid compression error.\n")
+	}
+}
@@ -0,0 +1,297 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"github.com/adyzng/go-duka/core"
+	"github.com/adyzng/go-duka/hst"
+	"github.com/adyzng/go-duka/misc"
+
+	// pure go sqlite driver, registered as `sqlite`
+	_ "modernc.org/sqlite"
+)
+
+var (
+	log = misc.NewLogger("SQLite", 3)
+
+	// TxRows is the max rows of one transaction, which is committed earlier
+	// if no more rows are pending
+	TxRows = 10000
+
+	// ticks with the same timestamp are kept in order by `seq`
+	schema = []string{
+		`PRAGMA journal_mode = WAL`,
+		`PRAGMA synchronous = NORMAL`,
+		`PRAGMA busy_timeout = 30000`,
+		`CREATE TABLE IF NOT EXISTS ticks (
+			symbol     TEXT    NOT NULL,
+			timestamp  INTEGER NOT NULL,
+			seq        INTEGER NOT NULL DEFAULT 0,
+			ask        REAL    NOT NULL,
+			bid        REAL    NOT NULL,
+			ask_volume REAL    NOT NULL,
+			bid_volume REAL    NOT NULL,
+			PRIMARY KEY (symbol, timestamp, seq)
+		) WITHOUT ROWID`,
+		`CREATE TABLE IF NOT EXISTS bars (
+			symbol     TEXT    NOT NULL,
+			timeframe  TEXT    NOT NULL,
+			timestamp  INTEGER NOT NULL,
+			open       REAL    NOT NULL,
+			high       REAL    NOT NULL,
+			low        REAL    NOT NULL,
+			close      REAL    NOT NULL,
+			volume     INTEGER NOT NULL,
+			spread     INTEGER NOT NULL,
+			ticks      INTEGER NOT NULL,
+			PRIMARY KEY (symbol, timeframe, timestamp)
+		) WITHOUT ROWID`,
+		`CREATE INDEX IF NOT EXISTS bars_symbol_timestamp ON bars (symbol, timestamp)`,
+	}
+
+	// the ticks of the time range are deleted before upsert
+	deleteTicks = `DELETE FROM ticks WHERE symbol = ? AND timestamp BETWEEN ? AND ?`
+
+	upsertTick = `INSERT INTO ticks (symbol, timestamp, seq, ask, bid, ask_volume, bid_volume)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (symbol, timestamp, seq) DO UPDATE SET
+			ask = excluded.ask, bid = excluded.bid,
+			ask_volume = excluded.ask_volume, bid_volume = excluded.bid_volume`
+
+	upsertBar = `INSERT INTO bars (symbol, timeframe, timestamp, open, high, low, close, volume, spread, ticks)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (symbol, timeframe, timestamp) DO UPDATE SET
+			open = excluded.open, high = excluded.high, low = excluded.low, close = excluded.close,
+			volume = excluded.volume, spread = excluded.spread, ticks = excluded.ticks`
+)
+
+// sqlRow is the arguments of one upsert statement
+type sqlRow []interface{}
+
+// SQLite save ticks or bars of many symbols into one sqlite database.
+// Timestamps are epoch milliseconds in UTC, existing rows are replaced,
+// so the same database can be appended across runs. The existing ticks within
+// the time range of each PackTicks are deleted first, so a run with fewer ticks
+// of the same millisecond leaves no stale rows.
+//
+// Each output writes through its own connection, the transactions are kept
+// short so the outputs of other timeframes on the same database are not blocked.
+//
+type SQLite struct {
+	fpath   string
+	symbol  string
+	period  string
+	bars    bool
+	digits  int
+	chClose chan struct{}
+	chRows  chan []sqlRow
+}
+
+// New sqlite output of ticks into database `fpath`
+//
+func New(fpath, symbol string) *SQLite {
+	return newSQLite(fpath, "", false, symbol)
+}
+
+// NewBars sqlite output of `period` bars into database `fpath`
+//
+func NewBars(fpath, period, symbol string) *SQLite {
+	return newSQLite(fpath, period, true, symbol)
+}
+
+func newSQLite(fpath, period string, bars bool, symbol string) *SQLite {
+	s := &SQLite{
+		fpath:   fpath,
+		symbol:  symbol,
+		period:  period,
+		bars:    bars,
+		digits:  core.Digits(symbol),
+		chClose: make(chan struct{}, 1),
+		chRows:  make(chan []sqlRow, 64),
+	}
+
+	go s.worker()
+	return s
+}
+
+// Open sqlite database and create tables if not exist
+//
+func Open(fpath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	// one connection, so the pragmas apply to all the statements
+	db.SetMaxOpenConns(1)
+	for _, stmt := range schema {
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("init sqlite %s failed: %v", fpath, err)
+		}
+	}
+	return db, nil
+}
+
+// Finish complete database writing
+//
+func (s *SQLite) Finish() error {
+	close(s.chRows)
+	<-s.chClose
+	return nil
+}
+
+// PackTicks handle ticks data, the ticks are aggregated into one bar in bars output
+//
+func (s *SQLite) PackTicks(barTimestamp uint32, ticks []*core.TickData) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	if s.bars {
+		bar := hst.NewBar(barTimestamp, ticks)
+		bar.Spread = hst.AvgSpread(ticks, math.Pow10(-s.digits))
+		s.chRows <- []sqlRow{{
+			s.symbol, s.period, int64(barTimestamp) * 1000,
+			bar.Open, bar.High, bar.Low, bar.Close,
+			int64(bar.Volume), int64(bar.Spread), len(ticks),
+		}}
+		return nil
+	}
+
+	rows := make([]sqlRow, 0, len(ticks))
+	for _, tick := range ticks {
+		// seq is filled by worker
+		rows = append(rows, sqlRow{
+			s.symbol, tick.Timestamp, 0,
+			tick.Ask, tick.Bid, tick.VolumeAsk, tick.VolumeBid,
+		})
+	}
+	s.chRows <- rows
+	return nil
+}
+
+// worker goroutine which upsert rows in transactions, the transaction is committed
+// once no more rows are pending or TxRows is reached
+//
+func (s *SQLite) worker() error {
+	var (
+		err    error
+		rows   int
+		saved  int64
+		lastTs int64
+		seq    int
+		tx     *sql.Tx
+		stmt   *sql.Stmt
+		purge  *sql.Stmt
+		query  = upsertTick
+	)
+	if s.bars {
+		query = upsertBar
+	}
+
+	defer func() {
+		for range s.chRows {
+		}
+		close(s.chClose)
+		if s.bars {
+			log.Info("%s Saved Bars: %d.", s.period, saved)
+		} else {
+			log.Info("Saved Ticks: %d.", saved)
+		}
+	}()
+
+	db, err := Open(s.fpath)
+	if err != nil {
+		log.Error("Open %s failed: %v.", s.fpath, err)
+		return err
+	}
+	defer db.Close()
+
+	begin := func() error {
+		if tx, err = db.Begin(); err != nil {
+			return err
+		}
+		if stmt, err = tx.Prepare(query); err != nil || s.bars {
+			return err
+		}
+		purge, err = tx.Prepare(deleteTicks)
+		return err
+	}
+	commit := func() error {
+		stmt.Close()
+		if purge != nil {
+			purge.Close()
+		}
+		t := tx
+		tx = nil
+		if err := t.Commit(); err != nil {
+			return err
+		}
+		saved += int64(rows)
+		rows = 0
+		return nil
+	}
+
+	for batch := range s.chRows {
+		if tx == nil {
+			if err = begin(); err != nil {
+				log.Error("Begin transaction %s failed: %v.", s.fpath, err)
+				break
+			}
+		}
+
+		if !s.bars {
+			first, last := batch[0][1], batch[len(batch)-1][1]
+			if _, err = purge.Exec(s.symbol, first, last); err != nil {
+				log.Error("Delete ticks %s failed: %v.", s.fpath, err)
+				break
+			}
+		}
+
+		for _, row := range batch {
+			if !s.bars {
+				ts := row[1].(int64)
+				if ts == lastTs {
+					seq++
+				} else {
+					lastTs, seq = ts, 0
+				}
+				row[2] = seq
+			}
+
+			if _, err = stmt.Exec(row...); err != nil {
+				log.Error("Upsert %s failed: %v.", s.fpath, err)
+				break
+			}
+			rows++
+		}
+		if err != nil {
+			break
+		}
+
+		if rows >= TxRows || len(s.chRows) == 0 {
+			if err = commit(); err != nil {
+				log.Error("Commit %s failed: %v.", s.fpath, err)
+				break
+			}
+		}
+	}
+
+	if tx != nil {
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = commit(); err != nil {
+			log.Error("Commit %s failed: %v.", s.fpath, err)
+			return err
+		}
+	}
+	if err == nil {
+		log.Trace("Saved database %s.", s.fpath)
+	}
+	return err
+}
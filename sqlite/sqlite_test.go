@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/go-duka/core"
+)
+
+func TestSQLiteUpsert(t *testing.T) {
+	dest, err := ioutil.TempDir("", "duka")
+	if err != nil {
+		t.Fatalf("Create temp dir failed: %v.\n", err)
+	}
+	defer os.RemoveAll(dest)
+
+	day := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	ticks := make([]*core.TickData, 0)
+	for m := 0; m < 10; m++ {
+		ts := day.Add(time.Duration(m/2)*time.Minute).Unix() * 1000
+		ticks = append(ticks, &core.TickData{
+			Timestamp: ts,
+			Ask:       1.05110 + float64(m)*0.0001,
+			Bid:       1.05100 + float64(m)*0.0001,
+			VolumeAsk: 1.5,
+			VolumeBid: 2.5,
+		})
+	}
+
+	defer func(rows int) { TxRows = rows }(TxRows)
+	TxRows = 3
+	fpath := filepath.Join(dest, "duka.db")
+	for _, symbol := range []string{"EURUSD", "EURUSD", "USDJPY"} {
+		s := New(fpath, symbol)
+		s.PackTicks(0, ticks)
+		s.Finish()
+
+		b := NewBars(fpath, "M1", symbol)
+		for m := 0; m < 10; m += 2 {
+			b.PackTicks(uint32(ticks[m].Timestamp/1000), ticks[m:m+2])
+		}
+		b.Finish()
+	}
+
+	// outputs of other timeframes write the same database at the same time,
+	// the first H1 bar is committed while the H1 output is still open
+	h1 := NewBars(fpath, "H1", "GBPUSD")
+	h1.PackTicks(uint32(day.Unix()), ticks[:6])
+	if n := waitRows(fpath, `SELECT COUNT(*) FROM bars WHERE symbol = 'GBPUSD'`, 1); n != 1 {
+		t.Fatalf("Expect 1 committed GBPUSD H1 bar, got %d.\n", n)
+	}
+	m1 := New(fpath, "GBPUSD")
+	for m := 0; m < 10; m += 2 {
+		m1.PackTicks(0, ticks[m:m+2])
+	}
+	m1.Finish()
+	h1.PackTicks(uint32(day.Unix())+3600, ticks[6:])
+	h1.Finish()
+
+	db, err := Open(fpath)
+	if err != nil {
+		t.Fatalf("Open %s failed: %v.\n", fpath, err)
+	}
+	defer db.Close()
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM ticks WHERE symbol = 'EURUSD'`).Scan(&count)
+	if count != 10 {
+		t.Errorf("Expect 10 EURUSD ticks, got %d.\n", count)
+	}
+	db.QueryRow(`SELECT COUNT(*) FROM bars WHERE timeframe = 'M1'`).Scan(&count)
+	if count != 10 {
+		t.Errorf("Expect 10 M1 bars, got %d.\n", count)
+	}
+
+	db.QueryRow(`SELECT COUNT(*) FROM ticks WHERE symbol = 'GBPUSD'`).Scan(&count)
+	if count != 10 {
+		t.Errorf("Expect 10 GBPUSD ticks, got %d.\n", count)
+	}
+	db.QueryRow(`SELECT COUNT(*) FROM bars WHERE symbol = 'GBPUSD' AND timeframe = 'H1'`).Scan(&count)
+	if count != 2 {
+		t.Errorf("Expect 2 GBPUSD H1 bars, got %d.\n", count)
+	}
+
+	var bid float64
+	db.QueryRow(`SELECT bid FROM ticks WHERE symbol = 'USDJPY' AND timestamp = ? AND seq = 1`, ticks[9].Timestamp).Scan(&bid)
+	if bid != ticks[9].Bid {
+		t.Errorf("Expect bid %f, got %f.\n", ticks[9].Bid, bid)
+	}
+
+	var high float64
+	var n int
+	db.QueryRow(`SELECT high, ticks FROM bars WHERE symbol = 'EURUSD' AND timestamp = ?`, ticks[2].Timestamp).Scan(&high, &n)
+	if high != ticks[3].Bid || n != 2 {
+		t.Errorf("Unexpected bar high %f, ticks %d.\n", high, n)
+	}
+
+	// re-run with one tick of each millisecond
+	s := New(fpath, "EURUSD")
+	for m := 0; m < 10; m += 2 {
+		s.PackTicks(0, ticks[m:m+1])
+	}
+	s.Finish()
+	db.QueryRow(`SELECT COUNT(*) FROM ticks WHERE symbol = 'EURUSD'`).Scan(&count)
+	if count != 5 {
+		t.Errorf("Expect 5 EURUSD ticks after re-run, got %d.\n", count)
+	}
+}
+
+// waitRows poll the count of `query` until it reaches `expect`, or a few seconds passed
+func waitRows(fpath, query string, expect int) int {
+	db, err := Open(fpath)
+	if err != nil {
+		return -1
+	}
+	defer db.Close()
+
+	var count int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if db.QueryRow(query).Scan(&count); count >= expect {
+			break
+		}
+	}
+	return count
+}